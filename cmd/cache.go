@@ -0,0 +1,231 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/d8x/amm/pkg/cache"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(cacheCMD)
+	cacheCMD.PersistentFlags().StringP("workdir", "w", "amm-workdir", "Working directory")
+	cacheCMD.AddCommand(cacheLsCMD, cachePruneCMD, cacheVerifyCMD, cacheExportCMD, cacheImportCMD)
+	cachePruneCMD.Flags().Duration("older-than", 0, "Remove versions not used for this long, e.g. 720h")
+	cachePruneCMD.Flags().String("max-size", "", "Remove least recently used versions until the cache fits, e.g. 20G")
+	cachePruneCMD.Flags().Int("keep", 0, "Keep only the newest versions of every mod")
+	cachePruneCMD.Flags().Bool("dry-run", false, "Only show what would be removed")
+	cacheVerifyCMD.Flags().Bool("remove", false, "Remove versions which fail the verification")
+}
+
+var cacheCMD = &cobra.Command{
+	Use:   "cache",
+	Short: "manage the downloaded mod versions",
+}
+
+var cacheLsCMD = &cobra.Command{
+	Use:   "ls [<mod id>...]",
+	Short: "list the cached mod versions",
+	Run: func(cmd *cobra.Command, args []string) {
+		modCache, err := openCache(cmd)
+		if err != nil {
+			fmt.Printf("error while opening cache: %v\n", err)
+			return
+		}
+		entries, err := cacheEntries(modCache, args)
+		if err != nil {
+			fmt.Printf("error while reading cache: %v\n", err)
+			return
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "MOD\tVERSION\tPLATFORM\tUPDATED\tSIZE\tLAST USED")
+		var total int64
+		for _, e := range entries {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", e.ModID, e.Key, e.Platform, formatUnix(e.TimeUpdated),
+				formatSize(e.Size), formatUnix(e.LastUsed.Unix()))
+			total += e.Size
+		}
+		w.Flush()
+		fmt.Printf("%d versions, %s\n", len(entries), formatSize(total))
+	},
+}
+
+var cachePruneCMD = &cobra.Command{
+	Use:   "prune",
+	Short: "remove cached mod versions by age, total size or count",
+	Run: func(cmd *cobra.Command, args []string) {
+		modCache, err := openCache(cmd)
+		if err != nil {
+			fmt.Printf("error while opening cache: %v\n", err)
+			return
+		}
+		opts := cache.PruneOptions{}
+		opts.OlderThan, _ = cmd.Flags().GetDuration("older-than")
+		opts.Keep, _ = cmd.Flags().GetInt("keep")
+		opts.DryRun, _ = cmd.Flags().GetBool("dry-run")
+		if maxSize, _ := cmd.Flags().GetString("max-size"); maxSize != "" {
+			if opts.MaxSize, err = parseSize(maxSize); err != nil {
+				fmt.Printf("error with max-size: %v\n", err)
+				return
+			}
+		}
+		removed, err := modCache.Prune(opts)
+		var freed int64
+		for _, e := range removed {
+			fmt.Printf("removed %s %s (%s)\n", e.ModID, e.Key, formatSize(e.Size))
+			freed += e.Size
+		}
+		if err != nil {
+			fmt.Printf("error while pruning cache: %v\n", err)
+		}
+		fmt.Printf("freed %s\n", formatSize(freed))
+	},
+}
+
+var cacheVerifyCMD = &cobra.Command{
+	Use:   "verify [<mod id>...]",
+	Short: "check the cached mod versions against their content hashes",
+	Run: func(cmd *cobra.Command, args []string) {
+		modCache, err := openCache(cmd)
+		if err != nil {
+			fmt.Printf("error while opening cache: %v\n", err)
+			return
+		}
+		entries, err := cacheEntries(modCache, args)
+		if err != nil {
+			fmt.Printf("error while reading cache: %v\n", err)
+			return
+		}
+		remove, _ := cmd.Flags().GetBool("remove")
+		for _, e := range entries {
+			if err := modCache.Verify(e); err != nil {
+				fmt.Printf("%s %s: %v\n", e.ModID, e.Key, err)
+				if remove {
+					if err := modCache.Remove(e); err != nil {
+						fmt.Printf("error while removing %s %s: %v\n", e.ModID, e.Key, err)
+					}
+				}
+				continue
+			}
+			fmt.Printf("%s %s: ok\n", e.ModID, e.Key)
+		}
+	},
+}
+
+var cacheExportCMD = &cobra.Command{
+	Use:   "export <file.tar.gz> [<mod id>...]",
+	Short: "write cached mod versions to an archive for machines without internet access",
+	Long: `Write cached mod versions to an archive. Import it on a machine without
+internet access and use --offline there. Without mod ids all versions are exported.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		modCache, err := openCache(cmd)
+		if err != nil {
+			fmt.Printf("error while opening cache: %v\n", err)
+			return
+		}
+		entries, err := cacheEntries(modCache, args[1:])
+		if err != nil {
+			fmt.Printf("error while reading cache: %v\n", err)
+			return
+		}
+		f, err := os.Create(args[0])
+		if err != nil {
+			fmt.Printf("error while creating %s: %v\n", args[0], err)
+			return
+		}
+		defer f.Close()
+		if err := modCache.Export(f, entries); err != nil {
+			fmt.Printf("error while exporting cache: %v\n", err)
+			return
+		}
+		fmt.Printf("exported %d versions to %s\n", len(entries), args[0])
+	},
+}
+
+var cacheImportCMD = &cobra.Command{
+	Use:   "import <file.tar.gz>",
+	Short: "add the mod versions of an exported archive to the cache",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		modCache, err := openCache(cmd)
+		if err != nil {
+			fmt.Printf("error while opening cache: %v\n", err)
+			return
+		}
+		f, err := os.Open(args[0])
+		if err != nil {
+			fmt.Printf("error while opening %s: %v\n", args[0], err)
+			return
+		}
+		defer f.Close()
+		imported, err := modCache.Import(f)
+		for _, e := range imported {
+			fmt.Printf("imported %s %s (%s)\n", e.ModID, e.Key, formatSize(e.Size))
+		}
+		if err != nil {
+			fmt.Printf("error while importing cache: %v\n", err)
+		}
+	},
+}
+
+func openCache(cmd *cobra.Command) (*cache.Cache, error) {
+	workDir, _ := cmd.Flags().GetString("workdir")
+	steamHandler, err := newSteamHandler(cmd, workDir)
+	if err != nil {
+		return nil, err
+	}
+	return steamHandler.Cache(), nil
+}
+
+func cacheEntries(modCache *cache.Cache, modIDs []string) ([]*cache.Entry, error) {
+	if len(modIDs) == 0 {
+		return modCache.List()
+	}
+	var entries []*cache.Entry
+	for _, id := range modIDs {
+		versions, err := modCache.Versions(id)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, versions...)
+	}
+	return entries, nil
+}
+
+var sizeUnits = []string{"B", "K", "M", "G", "T"}
+
+func formatSize(size int64) string {
+	value := float64(size)
+	unit := 0
+	for value >= 1024 && unit < len(sizeUnits)-1 {
+		value /= 1024
+		unit++
+	}
+	if unit == 0 {
+		return fmt.Sprintf("%dB", size)
+	}
+	return fmt.Sprintf("%.1f%s", value, sizeUnits[unit])
+}
+
+// parseSize reads sizes like 512M or 20G, plain numbers are bytes.
+func parseSize(size string) (int64, error) {
+	s := strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(size)), "B")
+	multiplier := int64(1)
+	for i := len(sizeUnits) - 1; i > 0; i-- {
+		if strings.HasSuffix(s, sizeUnits[i]) {
+			s = strings.TrimSuffix(s, sizeUnits[i])
+			multiplier = int64(1) << (10 * uint(i))
+			break
+		}
+	}
+	value, err := strconv.ParseFloat(s, 64)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("invalid size %q", size)
+	}
+	return int64(value * float64(multiplier)), nil
+}
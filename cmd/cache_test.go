@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		size string
+		want int64
+	}{
+		{"1024", 1024},
+		{"1b", 1},
+		{"1B", 1},
+		{"512m", 512 << 20},
+		{"512mb", 512 << 20},
+		{"512MB", 512 << 20},
+		{"20G", 20 << 30},
+		{"20gb", 20 << 30},
+		{" 1.5K ", 1536},
+		{"2t", 2 << 40},
+	}
+	for _, tt := range tests {
+		t.Run(tt.size, func(t *testing.T) {
+			got, err := parseSize(tt.size)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+	for _, size := range []string{"", "mb", "-1G", "20X", "1bb"} {
+		t.Run(size, func(t *testing.T) {
+			_, err := parseSize(size)
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/d8x/amm/pkg/config"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// settings are the merged configuration layers of the running command,
+	// cfg is their decoded form. Both are loaded before every command.
+	settings *config.Values
+	cfg      *config.Config
+)
+
+func init() {
+	rootCmd.AddCommand(configCMD)
+	configCMD.AddCommand(configShowCMD, configGetCMD, configSetCMD)
+	configSetCMD.Flags().Bool("system", false, "Write to the system configuration instead of the user one")
+}
+
+var configCMD = &cobra.Command{
+	Use:   "config",
+	Short: "show and change the amm configuration",
+	Long: `Settings are read from the system file, the user file, the --config file,
+AMM_* environment variables and flags, later ones override earlier ones.
+The variable of a key replaces dots and dashes with underscores, e.g.
+AMM_STEAM_GAME_ID sets steam.game-id.`,
+}
+
+var configShowCMD = &cobra.Command{
+	Use:   "show",
+	Short: "show all settings and where they come from",
+	Run: func(cmd *cobra.Command, args []string) {
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "KEY\tVALUE\tSOURCE")
+		for _, s := range config.Settings {
+			value, source, _ := settings.Get(s.Key)
+			fmt.Fprintf(w, "%s\t%s\t%s\n", s.Key, value, source)
+		}
+		w.Flush()
+	},
+}
+
+var configGetCMD = &cobra.Command{
+	Use:   "get <key>",
+	Short: "print the value of a setting",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		value, _, err := settings.Get(args[0])
+		if err != nil {
+			fmt.Printf("error while reading setting: %v\n", err)
+			return
+		}
+		fmt.Println(value)
+	},
+}
+
+var configSetCMD = &cobra.Command{
+	Use:   "set <key> <value>",
+	Short: "store a setting in the user, system or --config file",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		path, err := configFile(cmd)
+		if err != nil {
+			fmt.Printf("error while locating configuration: %v\n", err)
+			return
+		}
+		if err := config.WriteFile(path, args[0], args[1]); err != nil {
+			fmt.Printf("error while writing %s: %v\n", path, err)
+			return
+		}
+		fmt.Printf("%s = %s written to %s\n", args[0], args[1], path)
+	},
+}
+
+// configFile returns the file config set writes to.
+func configFile(cmd *cobra.Command) (string, error) {
+	if system, _ := cmd.Flags().GetBool("system"); system {
+		return config.SystemFile(), nil
+	}
+	if path, _ := cmd.Flags().GetString("config"); path != "" {
+		return path, nil
+	}
+	return config.UserFile()
+}
+
+// loadConfig merges the configuration layers with the flags given on the
+// command line. Flags of the command which were not given take the
+// configured value, so commands read the merged settings from their flags.
+// Setting their value leaves them unchanged, so Changed still tells whether
+// a flag was given on the command line.
+func loadConfig(cmd *cobra.Command, args []string) error {
+	path, _ := cmd.Flags().GetString("config")
+	values, err := config.Load(path, os.Environ())
+	if err != nil {
+		return fmt.Errorf("error while loading configuration: %w", err)
+	}
+	for _, s := range config.Settings {
+		name := flagName(s.Key)
+		if f := cmd.Flags().Lookup(name); f != nil && f.Changed {
+			if err := values.Set(s.Key, f.Value.String(), "flag --"+name); err != nil {
+				return err
+			}
+		}
+	}
+	c, err := values.Config()
+	if err != nil {
+		return err
+	}
+	for _, s := range config.Settings {
+		name := flagName(s.Key)
+		if f := cmd.Flags().Lookup(name); f != nil && !f.Changed {
+			value, _, _ := values.Get(s.Key)
+			if err := f.Value.Set(value); err != nil {
+				return fmt.Errorf("invalid value %q for %s: %w", value, s.Key, err)
+			}
+		}
+	}
+	settings, cfg = values, c
+	return nil
+}
+
+// flagName returns the flag overriding the key, steam.api is --steam-api.
+func flagName(key string) string {
+	return strings.Replace(key, ".", "-", -1)
+}
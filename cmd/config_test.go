@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "amm.properties")
+	if err := ioutil.WriteFile(path, []byte("workdir = /srv/file\nunpack-dir = /srv/unpacked\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cmd := &cobra.Command{Use: "test"}
+	cmd.Flags().String("config", "", "")
+	cmd.Flags().String("workdir", "amm-workdir", "")
+	cmd.Flags().String("unpack-dir", "amm-unpacked", "")
+	if err := cmd.ParseFlags([]string{"--config", path, "--workdir", "/srv/flag"}); err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, loadConfig(cmd, nil))
+
+	tests := []struct {
+		flag    string
+		want    string
+		changed bool
+	}{
+		{"workdir", "/srv/flag", true},
+		{"unpack-dir", "/srv/unpacked", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.flag, func(t *testing.T) {
+			value, _ := cmd.Flags().GetString(tt.flag)
+			assert.Equal(t, tt.want, value)
+			assert.Equal(t, tt.changed, cmd.Flags().Changed(tt.flag))
+		})
+	}
+	assert.Equal(t, "/srv/flag", cfg.WorkDir)
+	assert.Equal(t, "/srv/unpacked", cfg.UnpackDir)
+	_, source, _ := settings.Get("workdir")
+	assert.Equal(t, "flag --workdir", source)
+}
@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/d8x/amm/pkg/deps"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(depsCMD)
+	depsCMD.Flags().StringP("workdir", "w", "amm-workdir", "Working directory")
+	depsCMD.Flags().Bool("graph", false, "Print the dependency tree")
+	depsCMD.Flags().Bool("dot", false, "Export the dependency graph in graphviz dot format")
+}
+
+var depsCMD = &cobra.Command{
+	Use:   "deps <mod>...",
+	Short: "show the workshop items mods require",
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, cancel := commandContext(cmd)
+		defer cancel()
+		workDir, _ := cmd.Flags().GetString("workdir")
+		client := workshopClient(cmd, workDir)
+		mods, err := client.Resolve(ctx, args)
+		if err != nil {
+			fmt.Printf("error while resolving mods: %v\n", err)
+			return
+		}
+		graph, err := deps.Resolve(ctx, client, mods)
+		if err != nil {
+			fmt.Printf("error while resolving dependencies: %v\n", err)
+			return
+		}
+		titles := map[string]string{}
+		var ids []string
+		for id := range graph.Requires {
+			ids = append(ids, id)
+		}
+		if details, err := client.FileDetails(ctx, ids); err == nil {
+			for id, d := range details {
+				titles[id] = d.Title
+			}
+		}
+		order, orderErr := graph.Mods()
+		graphFlag, _ := cmd.Flags().GetBool("graph")
+		dot, _ := cmd.Flags().GetBool("dot")
+		switch {
+		case dot:
+			err = graph.WriteDOT(os.Stdout, titles)
+		case graphFlag:
+			err = graph.WriteTree(os.Stdout, titles)
+		case orderErr == nil:
+			for _, id := range order {
+				fmt.Printf("%s\t%s\n", id, titles[id])
+			}
+		}
+		if err != nil {
+			fmt.Printf("error while printing dependencies: %v\n", err)
+		}
+		if orderErr != nil {
+			fmt.Printf("error: %v\n", orderErr)
+		}
+	},
+}
@@ -0,0 +1,140 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+
+	"github.com/d8x/amm/pkg/server"
+	"github.com/d8x/amm/pkg/snapshot"
+	"github.com/d8x/amm/pkg/unpacker"
+	"github.com/d8x/amm/pkg/workshop"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(diffCMD)
+	diffCMD.Flags().StringP("workdir", "w", "amm-workdir", "Working directory")
+	diffCMD.Flags().String("from", "", "Snapshot or directory of the old version (default the newest snapshot)")
+	diffCMD.Flags().String("to", "", "Snapshot or directory of the new version (default the installed version)")
+	diffCMD.Flags().StringP("server-dir", "s", "", "ARK server directory the installed version is taken from")
+	diffCMD.Flags().String("platform", "", "Platform folder compared in raw downloads: windows or linux (default host platform)")
+}
+
+var diffCMD = &cobra.Command{
+	Use:   "diff <mod>",
+	Short: "list the files which changed between two versions of a mod",
+	Long: `List the files added, removed and changed between two versions of a mod.
+A version is a snapshot id or a directory with the unpacked or raw mod. Without
+--to the version installed where the --from snapshot was taken, or in the
+--server-dir server, is compared.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		workDir, _ := cmd.Flags().GetString("workdir")
+		from, _ := cmd.Flags().GetString("from")
+		to, _ := cmd.Flags().GetString("to")
+		serverDir, _ := cmd.Flags().GetString("server-dir")
+		ids, err := workshop.ParseRefs(args)
+		if err != nil || len(ids) != 1 {
+			fmt.Printf("error: invalid mod %s\n", args[0])
+			return
+		}
+		modID := ids[0]
+		platform, err := downloadPlatform(cmd, "")
+		if err != nil {
+			fmt.Printf("error with platform: %v\n", err)
+			return
+		}
+		store, err := snapshotStore(workDir)
+		if err != nil {
+			fmt.Printf("error while opening snapshots: %v\n", err)
+			return
+		}
+		installed := ""
+		if serverDir != "" {
+			srv, err := server.New(serverDir)
+			if err != nil {
+				fmt.Printf("error with server dir %s: %v\n", serverDir, err)
+				return
+			}
+			installed = filepath.Join(srv.ModsDir(), modID)
+		}
+		fromDir, snapTarget, err := diffVersion(store, modID, from, installed)
+		if err != nil {
+			fmt.Printf("error with --from: %v\n", err)
+			return
+		}
+		if installed == "" && snapTarget != "" {
+			installed = filepath.Join(snapTarget, modID)
+		}
+		toDir := installed
+		if to != "" {
+			toDir, _, err = diffVersion(store, modID, to, "")
+		} else if toDir == "" {
+			err = errors.New("no installed version known, set --to or --server-dir")
+		}
+		if err != nil {
+			fmt.Printf("error with --to: %v\n", err)
+			return
+		}
+		changes, err := unpacker.Diff(fromDir, toDir, platform)
+		if err != nil {
+			fmt.Printf("error while comparing %s and %s: %v\n", fromDir, toDir, err)
+			return
+		}
+		if len(changes) == 0 {
+			fmt.Println("no changes")
+			return
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "CHANGE\tFILE\tOLD\tNEW\tDELTA")
+		var delta int64
+		for _, c := range changes {
+			delta += c.Delta()
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", c.Kind, c.Path, diffSize(c.Kind != unpacker.FileAdded, c.OldSize),
+				diffSize(c.Kind != unpacker.FileRemoved, c.NewSize), formatDelta(c.Delta()))
+		}
+		tw.Flush()
+		fmt.Printf("%d files changed, %s\n", len(changes), formatDelta(delta))
+	},
+}
+
+// diffVersion returns the directory of a version given by snapshot id or
+// path, and the target of the snapshot. Without a version the newest
+// snapshot taken in the installed directory's target, or anywhere, is used.
+func diffVersion(store *snapshot.Store, modID, version, installed string) (string, string, error) {
+	if version == "" {
+		target := ""
+		if installed != "" {
+			target = filepath.Dir(installed)
+		}
+		snap, err := selectSnapshot(store, modID, "", target)
+		if err != nil {
+			return "", "", err
+		}
+		return snap.ContentDir(), snap.Target, nil
+	}
+	if snap, err := store.Get(modID, version); err == nil {
+		return snap.ContentDir(), snap.Target, nil
+	}
+	if stat, err := os.Stat(version); err != nil || !stat.IsDir() {
+		return "", "", fmt.Errorf("%s is neither a snapshot of mod %s nor a directory", version, modID)
+	}
+	return version, "", nil
+}
+
+func diffSize(known bool, size int64) string {
+	if !known {
+		return "-"
+	}
+	return formatSize(size)
+}
+
+func formatDelta(delta int64) string {
+	if delta < 0 {
+		return "-" + formatSize(-delta)
+	}
+	return "+" + formatSize(delta)
+}
@@ -1,9 +1,12 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
+	"strings"
 
 	"github.com/d8x/amm/pkg/steam"
+	"github.com/d8x/amm/pkg/unpacker"
 	"github.com/spf13/cobra"
 )
 
@@ -11,42 +14,169 @@ const steamCMDDownload = "steamcmd"
 
 func init() {
 	rootCmd.AddCommand(downloadCMD)
-	downloadCMD.Flags().StringSliceP("mods", "m", []string{}, "Set mod ids")
-	downloadCMD.Flags().BoolP("unpack", "u", false, "Unpack the mods")
-	downloadCMD.Flags().StringP("workdir", "w", "amm-workdir", "Working directory")
+	downloadCMD.Flags().StringSliceP("mods", "m", []string{}, "Set mod ids, workshop urls, collections or @files with one per line")
+	addDownloadFlags(downloadCMD, false)
+	downloadCMD.Flags().String("sha256", "", "Expected sha256 of the steamcmd archive")
+	downloadCMD.Flags().String("pin-file", "", "File with pinned steamcmd archive checksums")
+	downloadCMD.Flags().String("mirror", "", "Download steamcmd from this http(s) url")
+	downloadCMD.Flags().String("proxy", "", "HTTP proxy used to download steamcmd")
+	downloadCMD.Flags().Bool("allow-unverified", false, "Unpack the steamcmd archive even without a checksum")
 }
 
 var downloadCMD = &cobra.Command{
-	Use:   "download",
+	Use:   "download [steamcmd | <mod>...]",
 	Short: "download an asset",
 	Run: func(cmd *cobra.Command, args []string) {
+		ctx, cancel := commandContext(cmd)
+		defer cancel()
 		workDir, err := cmd.Flags().GetString("workdir")
 		if err != nil {
 			fmt.Printf("error with workdir %v\n", err)
 			return
 		}
-		steamHandler, err := steam.NewSteamHandler(workDir)
+		steamHandler, err := newSteamHandler(cmd, workDir)
 		if err != nil {
 			fmt.Printf("error when creating steam handler %v\n", err)
 			return
 		}
-		mods, _ := cmd.Flags().GetStringSlice("mods")
-		// unpack, _:= cmd.Flags().GetBool("unpack")
-		for _, modID := range mods {
-			location, err := steamHandler.DownloadMod(modID)
-			if err != nil {
-				fmt.Printf("error while downloading mod: %v\n", err)
+		for _, a := range args {
+			if strings.EqualFold(a, steamCMDDownload) {
+				if err := downloadSteamCMD(ctx, cmd, steamHandler); err != nil {
+					fmt.Printf("error while downloading steamcmd: %v\n", err)
+				}
+				return
 			}
-			fmt.Printf("mod downloaded %s\n", location)
 		}
-		// for _, a := range args {
-		// 	if strings.EqualFold(a, steamCMDDownload) {
-		// 		fmt.Println("not supported")
-		// 		return
-		// 	} else {
-		//
-		// 	}
-		// }
-
+		refs, _ := cmd.Flags().GetStringSlice("mods")
+		mods, err := resolveMods(ctx, cmd, workDir, append(refs, args...))
+		if err != nil {
+			fmt.Printf("error while resolving mods: %v\n", err)
+			return
+		}
+		downloadMods(ctx, cmd, steamHandler, mods)
 	},
 }
+
+// newSteamHandler creates the handler for the workdir, it serves mods only
+// from the cache with --offline and logs in with the --steam-user account.
+func newSteamHandler(cmd *cobra.Command, workDir string) (*steam.SteamHandler, error) {
+	steamHandler, err := steam.NewSteamHandler(workDir, cfg)
+	if err != nil {
+		return nil, err
+	}
+	steamHandler.Offline = isOffline(cmd)
+	steamHandler.Login = steamLogin(cmd)
+	return steamHandler, nil
+}
+
+// newModUnpacker creates the unpacker for the raw mod which leaves the
+// --min-free margin on the filesystem it writes to.
+func newModUnpacker(cmd *cobra.Command, rawModPath, dir string) (*unpacker.ModUnpacker, error) {
+	margin, err := minFree(cmd)
+	if err != nil {
+		return nil, err
+	}
+	modUnpacker, err := unpacker.NewModsUnpacker(rawModPath, dir, cfg)
+	if err != nil {
+		return nil, err
+	}
+	modUnpacker.MinFree = margin
+	return modUnpacker, nil
+}
+
+// addDownloadFlags registers the flags used by downloadMods.
+func addDownloadFlags(c *cobra.Command, unpack bool) {
+	c.Flags().BoolP("unpack", "u", unpack, "Unpack the mods")
+	c.Flags().StringP("workdir", "w", "amm-workdir", "Working directory")
+	c.Flags().IntP("concurrency", "c", 1, "Number of parallel steamcmd downloads")
+	c.Flags().String("unpack-dir", "amm-unpacked", "Directory the mods are unpacked to")
+	c.Flags().Bool("incremental", false, "Only unpack the archives which changed since the last incremental unpack")
+	addPlatformFlag(c)
+}
+
+func addPlatformFlag(c *cobra.Command) {
+	c.Flags().String("platform", "", "Download the mod content for this platform: windows or linux (default host platform)")
+}
+
+// downloadPlatform returns the --platform flag, fallback is used when it is not set.
+func downloadPlatform(cmd *cobra.Command, fallback string) (string, error) {
+	platform, _ := cmd.Flags().GetString("platform")
+	if platform == "" {
+		platform = fallback
+	}
+	return platform, steam.ValidatePlatform(platform)
+}
+
+// downloadMods downloads the mods in parallel and unpacks each one into
+// --unpack-dir as soon as it is downloaded when --unpack is set.
+func downloadMods(ctx context.Context, cmd *cobra.Command, steamHandler *steam.SteamHandler, mods []string) {
+	unpack, _ := cmd.Flags().GetBool("unpack")
+	unpackDir, _ := cmd.Flags().GetString("unpack-dir")
+	if !unpack {
+		unpackDir = ""
+	}
+	downloadModsTo(ctx, cmd, steamHandler, mods, unpackDir)
+}
+
+// downloadModsTo downloads the mods in parallel and unpacks each one into
+// unpackDir as soon as it is downloaded, an empty unpackDir only downloads.
+func downloadModsTo(ctx context.Context, cmd *cobra.Command, steamHandler *steam.SteamHandler, mods []string, unpackDir string) {
+	incremental, _ := cmd.Flags().GetBool("incremental")
+	concurrency, _ := cmd.Flags().GetInt("concurrency")
+	workDir, _ := cmd.Flags().GetString("workdir")
+	platform, err := downloadPlatform(cmd, "")
+	if err != nil {
+		fmt.Printf("error with platform: %v\n", err)
+		return
+	}
+	mods, details := checkAvailable(ctx, workshopClient(cmd, workDir), mods)
+	if err := checkSpace(cmd, steamHandler, mods, details, platform, unpackDir, false); err != nil {
+		fmt.Printf("error: %v\n", err)
+		return
+	}
+	scheduler := steam.NewScheduler(steamHandler, concurrency)
+	scheduler.Manifests = currentManifests(details)
+	scheduler.Platform = platform
+	for result := range scheduler.Download(ctx, mods) {
+		if result.Err != nil {
+			fmt.Printf("error while downloading mod %s: %v\n", result.ModID, result.Err)
+			continue
+		}
+		title := result.ModID
+		if d, ok := details[result.ModID]; ok {
+			title = fmt.Sprintf("%s (%s)", d.Title, result.ModID)
+		}
+		action := "downloaded"
+		if result.Cached {
+			action = "found in cache"
+		}
+		fmt.Printf("mod %s %s at %s (%s, updated %s, manifest %s)\n", title, action, result.Location,
+			result.Platform, formatUnix(result.Item.TimeUpdated), result.Item.Manifest)
+		if unpackDir == "" {
+			continue
+		}
+		modUnpacker, err := newModUnpacker(cmd, result.Location, unpackDir)
+		if err != nil {
+			fmt.Printf("error when creating unpacker for %s: %v\n", result.ModID, err)
+			continue
+		}
+		modUnpacker.Incremental = incremental
+		takeSnapshot(workDir, unpackDir, result.ModID, result.Item.Manifest)
+		if err := modUnpacker.Unpack(ctx); err != nil {
+			fmt.Printf("error while unpacking mod %s: %v\n", result.ModID, err)
+			continue
+		}
+		fmt.Printf("mod unpacked %s\n", result.ModID)
+		recordInstall(workDir, unpackDir, result, details)
+	}
+}
+
+func downloadSteamCMD(ctx context.Context, cmd *cobra.Command, steamHandler *steam.SteamHandler) error {
+	opts := steam.CMDDownloadOptions{}
+	opts.SHA256, _ = cmd.Flags().GetString("sha256")
+	opts.PinFile, _ = cmd.Flags().GetString("pin-file")
+	opts.URL, _ = cmd.Flags().GetString("mirror")
+	opts.Proxy, _ = cmd.Flags().GetString("proxy")
+	opts.AllowUnverified, _ = cmd.Flags().GetBool("allow-unverified")
+	return steamHandler.DownloadCMD(ctx, opts)
+}
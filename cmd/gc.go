@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/d8x/amm/pkg/server"
+	"github.com/d8x/amm/pkg/state"
+	"github.com/d8x/amm/pkg/unpacker"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(gcCMD)
+	gcCMD.Flags().StringP("server-dir", "s", "", "ARK server directory")
+	gcCMD.Flags().StringP("workdir", "w", "amm-workdir", "Working directory")
+	gcCMD.Flags().Bool("remove", false, "Remove the orphans instead of only reporting them")
+	gcCMD.Flags().Bool("force", false, "Remove the orphans even when ActiveMods is empty")
+	gcCMD.MarkFlagRequired("server-dir")
+}
+
+var gcCMD = &cobra.Command{
+	Use:   "gc",
+	Short: "find and remove orphaned mods in a server Mods folder",
+	Long: `Find the orphans in the Mods folder of a server: mods which are neither in
+ActiveMods nor installed by amm, .mod files without content folder, content
+folders without .mod file and leftovers of interrupted installs. They are only
+removed with --remove. Built-in mods and the official DLC maps are kept.
+When ActiveMods is empty or missing every mod looks unused, so nothing is
+removed unless --force is given as well.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		serverDir, _ := cmd.Flags().GetString("server-dir")
+		workDir, _ := cmd.Flags().GetString("workdir")
+		remove, _ := cmd.Flags().GetBool("remove")
+		force, _ := cmd.Flags().GetBool("force")
+		srv, err := openServer(serverDir)
+		if err != nil {
+			fmt.Printf("error with server dir %s: %v\n", serverDir, err)
+			return
+		}
+		db, err := state.Open(workDir)
+		if err != nil {
+			fmt.Printf("error while opening state: %v\n", err)
+			return
+		}
+		st, err := db.Read()
+		if err != nil {
+			fmt.Printf("error while reading state: %v\n", err)
+			return
+		}
+		keep := map[string]bool{}
+		for id := range st.Installs(srv.ModsDir()) {
+			keep[id] = true
+		}
+		orphans, err := srv.Orphans(keep)
+		if err != nil {
+			fmt.Printf("error while looking for orphans: %v\n", err)
+			return
+		}
+		if len(orphans) == 0 {
+			fmt.Println("no orphans found")
+			return
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tSIZE\tREASON\tPATHS")
+		var total int64
+		for _, o := range orphans {
+			total += o.Size
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", o.ID, formatSize(o.Size), o.Reason, strings.Join(o.Paths, ", "))
+		}
+		tw.Flush()
+		if !remove {
+			fmt.Printf("%d orphans using %s, run with --remove to delete them\n", len(orphans), formatSize(total))
+			return
+		}
+		active, err := srv.ActiveMods()
+		if err != nil {
+			fmt.Printf("error while reading ActiveMods: %v\n", err)
+			return
+		}
+		if len(active) == 0 && !force {
+			fmt.Printf("ActiveMods of %s is empty, run with --force to remove the orphans anyway\n", srv.GameUserSettingsPath())
+			return
+		}
+		var freed int64
+		var count int
+		var removed []string
+		for _, o := range orphans {
+			if err := srv.RemoveOrphan(o); err != nil {
+				fmt.Printf("error while removing orphan %s: %v\n", o.ID, err)
+				continue
+			}
+			freed += o.Size
+			count++
+			if o.Reason != server.OrphanLeftover {
+				removed = append(removed, o.ID)
+				if err := unpacker.RemoveManifest(srv.ModsDir(), o.ID); err != nil {
+					fmt.Printf("could not remove manifest of mod %s: %v\n", o.ID, err)
+				}
+			}
+		}
+		forgetInstalls(workDir, srv.ModsDir(), removed)
+		fmt.Printf("removed %d orphans, freed %s\n", count, formatSize(freed))
+	},
+}
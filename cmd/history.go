@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/d8x/amm/pkg/workshop"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(historyCMD)
+	historyCMD.Flags().StringP("workdir", "w", "amm-workdir", "Working directory")
+}
+
+var historyCMD = &cobra.Command{
+	Use:   "history <mod>",
+	Short: "list the snapshots of a mod which can be rolled back to",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		workDir, _ := cmd.Flags().GetString("workdir")
+		ids, err := workshop.ParseRefs(args)
+		if err != nil || len(ids) != 1 {
+			fmt.Printf("error: invalid mod %s\n", args[0])
+			return
+		}
+		store, err := snapshotStore(workDir)
+		if err != nil {
+			fmt.Printf("error while opening snapshots: %v\n", err)
+			return
+		}
+		snaps, err := store.List(ids[0])
+		if err != nil {
+			fmt.Printf("error while listing snapshots: %v\n", err)
+			return
+		}
+		if len(snaps) == 0 {
+			fmt.Printf("no snapshots of mod %s\n", ids[0])
+			return
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "SNAPSHOT\tUPDATED\tMANIFEST\tPLATFORM\tTAKEN\tSIZE\tTARGET")
+		for _, snap := range snaps {
+			size, err := snap.Size()
+			if err != nil {
+				fmt.Printf("error while reading snapshot %s: %v\n", snap.ID, err)
+				continue
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", snap.ID, formatUnix(snap.TimeUpdated), orDash(snap.Manifest),
+				orDash(snap.Platform), snap.Created.Local().Format("2006-01-02 15:04"), formatSize(size), snap.Target)
+		}
+		tw.Flush()
+	},
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
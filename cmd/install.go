@@ -0,0 +1,145 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/d8x/amm/pkg/deps"
+	"github.com/d8x/amm/pkg/server"
+	"github.com/d8x/amm/pkg/steam"
+	"github.com/d8x/amm/pkg/unpacker"
+	"github.com/d8x/amm/pkg/workshop"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(installCMD)
+	installCMD.Flags().StringP("server-dir", "s", "", "ARK server directory")
+	installCMD.Flags().StringP("workdir", "w", "amm-workdir", "Working directory")
+	installCMD.Flags().IntP("concurrency", "c", 1, "Number of parallel steamcmd downloads")
+	installCMD.Flags().Bool("no-deps", false, "Do not install the workshop items the mods require")
+	installCMD.Flags().String("platform", "", "Install the mod content for this platform: windows or linux (default server platform)")
+	installCMD.MarkFlagRequired("server-dir")
+}
+
+var installCMD = &cobra.Command{
+	Use:   "install <mod>...",
+	Short: "download mods with their dependencies and install them into a server",
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, cancel := commandContext(cmd)
+		defer cancel()
+		serverDir, _ := cmd.Flags().GetString("server-dir")
+		workDir, _ := cmd.Flags().GetString("workdir")
+		srv, err := openServer(serverDir)
+		if err != nil {
+			fmt.Printf("error with server dir %s: %v\n", serverDir, err)
+			return
+		}
+		steamHandler, err := newSteamHandler(cmd, workDir)
+		if err != nil {
+			fmt.Printf("error when creating steam handler %v\n", err)
+			return
+		}
+		client := workshopClient(cmd, workDir)
+		mods, err := client.Resolve(ctx, args)
+		if err != nil {
+			fmt.Printf("error while resolving mods: %v\n", err)
+			return
+		}
+		graph := &deps.Graph{Roots: mods, Requires: map[string][]string{}}
+		if noDeps, _ := cmd.Flags().GetBool("no-deps"); !noDeps {
+			if graph, err = deps.Resolve(ctx, client, mods); err != nil {
+				fmt.Printf("error while resolving dependencies: %v\n", err)
+				return
+			}
+		}
+		all, err := graph.Mods()
+		if err != nil {
+			fmt.Printf("error while resolving dependencies: %v\n", err)
+			return
+		}
+		all, details := checkAvailable(ctx, client, all)
+		installed := installMods(ctx, cmd, steamHandler, srv, all, details)
+		if err := activateMods(srv, graph, installed); err != nil {
+			fmt.Printf("error while updating ActiveMods: %v\n", err)
+		}
+	},
+}
+
+// openServer opens the server and completes the installs into its Mods
+// folder which a previous run did not finish.
+func openServer(serverDir string) (*server.Server, error) {
+	srv, err := server.New(serverDir)
+	if err != nil {
+		return nil, err
+	}
+	recovered, err := unpacker.Recover(srv.ModsDir())
+	for _, id := range recovered {
+		fmt.Printf("completed interrupted install of mod %s\n", id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("recovering interrupted installs: %w", err)
+	}
+	return srv, nil
+}
+
+// installMods downloads the mods and installs each one into the server as
+// soon as it is downloaded. It returns the installed mods.
+func installMods(ctx context.Context, cmd *cobra.Command, steamHandler *steam.SteamHandler, srv *server.Server,
+	mods []string, details map[string]*workshop.FileDetails) []string {
+	concurrency, _ := cmd.Flags().GetInt("concurrency")
+	workDir, _ := cmd.Flags().GetString("workdir")
+	platform, err := downloadPlatform(cmd, srv.Platform())
+	if err != nil {
+		fmt.Printf("error with platform: %v\n", err)
+		return nil
+	}
+	if err := checkSpace(cmd, steamHandler, mods, details, platform, srv.ModsDir(), true); err != nil {
+		fmt.Printf("error: %v\n", err)
+		return nil
+	}
+	scheduler := steam.NewScheduler(steamHandler, concurrency)
+	scheduler.Manifests = currentManifests(details)
+	scheduler.Platform = platform
+	var installed []string
+	for result := range scheduler.Download(ctx, mods) {
+		if result.Err != nil {
+			fmt.Printf("error while downloading mod %s: %v\n", result.ModID, result.Err)
+			continue
+		}
+		modUnpacker, err := newModUnpacker(cmd, result.Location, srv.ModsDir())
+		if err != nil {
+			fmt.Printf("error when creating unpacker for %s: %v\n", result.ModID, err)
+			continue
+		}
+		modUnpacker.Platform = platform
+		takeSnapshot(workDir, srv.ModsDir(), result.ModID, result.Item.Manifest)
+		if err := modUnpacker.Install(ctx, srv.ModsDir()); err != nil {
+			fmt.Printf("error while installing mod %s: %v\n", result.ModID, err)
+			continue
+		}
+		fmt.Printf("mod installed %s\n", result.ModID)
+		recordInstall(workDir, srv.ModsDir(), result, details)
+		installed = append(installed, result.ModID)
+	}
+	return installed
+}
+
+// activateMods adds the mods to ActiveMods and orders the whole list so
+// dependencies are loaded before the mods requiring them.
+func activateMods(srv *server.Server, graph *deps.Graph, mods []string) error {
+	return srv.UpdateActiveMods(func(active []string) ([]string, error) {
+		present := map[string]bool{}
+		for _, id := range active {
+			present[id] = true
+		}
+		for _, id := range mods {
+			if !present[id] {
+				active = append(active, id)
+				present[id] = true
+			}
+		}
+		return graph.Sort(active)
+	})
+}
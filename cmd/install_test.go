@@ -0,0 +1,143 @@
+package cmd
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+)
+
+// runCommand executes amm with args and returns what it printed.
+func runCommand(t *testing.T, args ...string) string {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	out := make(chan string)
+	go func() {
+		var b bytes.Buffer
+		io.Copy(&b, r)
+		out <- b.String()
+	}()
+	defer resetFlags(rootCmd)
+	rootCmd.SetArgs(args)
+	err = rootCmd.Execute()
+	os.Stdout = stdout
+	w.Close()
+	assert.NoError(t, err)
+	return <-out
+}
+
+// resetFlags puts the flags given to the last command back to their
+// defaults, cobra keeps them between runs.
+func resetFlags(c *cobra.Command) {
+	reset := func(f *pflag.Flag) {
+		if !f.Changed {
+			return
+		}
+		if s, ok := f.Value.(pflag.SliceValue); ok {
+			s.Replace(nil)
+		} else {
+			f.Value.Set(f.DefValue)
+		}
+		f.Changed = false
+	}
+	c.Flags().VisitAll(reset)
+	c.PersistentFlags().VisitAll(reset)
+	for _, sub := range c.Commands() {
+		resetFlags(sub)
+	}
+}
+
+// newServerDir creates an ARK server with one installed mod and the
+// leftover of an interrupted install in its Mods folder.
+func newServerDir(t *testing.T) string {
+	dir := t.TempDir()
+	modsDir := filepath.Join(dir, "ShooterGame", "Content", "Mods")
+	for _, d := range []string{filepath.Join(modsDir, "731604991"), filepath.Join(modsDir, ".staging-731604991-1")} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(modsDir, "731604991", "mod.info"), []byte("info"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(modsDir, "731604991.mod"), []byte("mod"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestOpenServer(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{"list", []string{"list", "--output", "csv"}, []string{"731604991", "installed"}},
+		{"gc", []string{"gc"}, []string{".staging-731604991-1", "leftover"}},
+		{"verify", []string{"verify", "731604991"}, []string{"mod 731604991 has no manifest"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append(tt.args, "--offline", "--server-dir", newServerDir(t), "--workdir", t.TempDir())
+			out := runCommand(t, args...)
+			assert.NotContains(t, out, "error with server dir")
+			for _, want := range tt.want {
+				assert.Contains(t, out, want)
+			}
+		})
+	}
+}
+
+func TestGCWithoutActiveMods(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		want    string
+		removed bool
+	}{
+		{"refused", []string{"--remove"}, "run with --force", false},
+		{"forced", []string{"--remove", "--force"}, "removed 2 orphans", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := newServerDir(t)
+			args := append([]string{"gc", "--offline", "--server-dir", dir, "--workdir", t.TempDir()}, tt.args...)
+			out := runCommand(t, args...)
+			assert.Contains(t, out, tt.want)
+			_, err := os.Stat(filepath.Join(dir, "ShooterGame", "Content", "Mods", "731604991"))
+			assert.Equal(t, tt.removed, os.IsNotExist(err))
+		})
+	}
+}
+
+func TestListLeavesPendingInstalls(t *testing.T) {
+	dir := newServerDir(t)
+	modsDir := filepath.Join(dir, "ShooterGame", "Content", "Mods")
+	stagingDir := filepath.Join(modsDir, ".staging-731604991-1")
+	if err := os.MkdirAll(filepath.Join(stagingDir, "731604991"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	journalFile := filepath.Join(modsDir, ".amm-journal", "731604991.json")
+	if err := os.MkdirAll(filepath.Dir(journalFile), 0755); err != nil {
+		t.Fatal(err)
+	}
+	entry := `{"mod_id":"731604991","staging_dir":"` + filepath.ToSlash(stagingDir) + `","started":"2020-10-16T18:02:17Z"}`
+	if err := ioutil.WriteFile(journalFile, []byte(entry), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out := runCommand(t, "list", "--output", "csv", "--offline", "--server-dir", dir, "--workdir", t.TempDir())
+	assert.Contains(t, out, "731604991")
+	assert.FileExists(t, journalFile)
+	assert.DirExists(t, filepath.Join(stagingDir, "731604991"), "the interrupted install is not completed")
+	assert.FileExists(t, filepath.Join(modsDir, "731604991", "mod.info"))
+}
@@ -0,0 +1,285 @@
+package cmd
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/d8x/amm/pkg/journal"
+	"github.com/d8x/amm/pkg/server"
+	"github.com/d8x/amm/pkg/state"
+	"github.com/d8x/amm/pkg/unpacker"
+	"github.com/d8x/amm/pkg/update"
+	"github.com/d8x/amm/pkg/workshop"
+	"github.com/spf13/cobra"
+)
+
+const (
+	modActivated = "activated"
+	modInstalled = "installed"
+	modOutdated  = "outdated"
+	modOrphaned  = "orphaned"
+	modMissing   = "missing"
+)
+
+func init() {
+	rootCmd.AddCommand(listCMD)
+	listCMD.Flags().StringP("server-dir", "s", "", "ARK server directory, without it the mods recorded in the workdir are listed")
+	listCMD.Flags().StringP("workdir", "w", "amm-workdir", "Working directory")
+	listCMD.Flags().StringP("output", "o", "table", "Output format: table, json or csv")
+}
+
+var listCMD = &cobra.Command{
+	Use:   "list",
+	Short: "list installed mods with their versions, sizes and status",
+	Long: `List installed mods with their versions, sizes and status. With --server-dir
+the Mods folder and ActiveMods of the server are read, so servers not set up by
+amm are listed too. A mod is activated when it is in ActiveMods, orphaned when
+its content folder or .mod file is missing and missing when only ActiveMods
+names it. Interrupted installs are only reported, list never changes the
+Mods folder.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, cancel := commandContext(cmd)
+		defer cancel()
+		output, _ := cmd.Flags().GetString("output")
+		serverDir, _ := cmd.Flags().GetString("server-dir")
+		workDir, _ := cmd.Flags().GetString("workdir")
+		db, err := state.Open(workDir)
+		if err != nil {
+			fmt.Printf("error while opening state: %v\n", err)
+			return
+		}
+		st, err := db.Read()
+		if err != nil {
+			fmt.Printf("error while reading state: %v\n", err)
+			return
+		}
+		var rows []modRow
+		if serverDir == "" {
+			rows = recordedMods(st)
+		} else {
+			srv, err := server.New(serverDir)
+			if err != nil {
+				fmt.Printf("error with server dir %s: %v\n", serverDir, err)
+				return
+			}
+			reportPending(srv)
+			if rows, err = serverMods(ctx, cmd, srv, st); err != nil {
+				fmt.Printf("error while listing mods: %v\n", err)
+				return
+			}
+		}
+		if err := writeModRows(os.Stdout, output, rows, serverDir == ""); err != nil {
+			fmt.Printf("error while writing list: %v\n", err)
+		}
+	},
+}
+
+// reportPending tells about the interrupted changes of the Mods folder,
+// which the next command changing the server completes. It writes to stderr
+// to keep json and csv output intact.
+func reportPending(srv *server.Server) {
+	pending, err := journal.Pending(srv.ModsDir())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not read interrupted installs: %v\n", err)
+		return
+	}
+	for _, id := range pending {
+		if id == "" {
+			fmt.Fprintf(os.Stderr, "change of %s was interrupted, the next install, remove or gc completes it\n", srv.GameUserSettingsPath())
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "install of mod %s was interrupted, the next install, remove or gc completes it\n", id)
+	}
+}
+
+type modRow struct {
+	ID          string `json:"id"`
+	Title       string `json:"title"`
+	TimeUpdated int64  `json:"time_updated,omitempty"`
+	Size        int64  `json:"size"`
+	Platform    string `json:"platform,omitempty"`
+	// Position is the 1-based position in ActiveMods, 0 when not active.
+	Position int    `json:"position,omitempty"`
+	Status   string `json:"status"`
+	Target   string `json:"target,omitempty"`
+}
+
+// recordedMods lists every install recorded in the state.
+func recordedMods(st *state.State) []modRow {
+	var rows []modRow
+	for _, id := range st.ModIDs() {
+		m := st.Mods[id]
+		for target, install := range m.Installs {
+			size, err := server.DirSize(filepath.Join(target, id))
+			status := modInstalled
+			if err != nil {
+				status = modMissing
+			}
+			rows = append(rows, modRow{
+				ID:          id,
+				Title:       m.Name,
+				TimeUpdated: install.TimeUpdated,
+				Size:        size,
+				Platform:    install.Platform,
+				Status:      status,
+				Target:      target,
+			})
+		}
+	}
+	return rows
+}
+
+// serverMods lists the mods in the Mods folder and ActiveMods of the server.
+func serverMods(ctx context.Context, cmd *cobra.Command, srv *server.Server, st *state.State) ([]modRow, error) {
+	installed, err := srv.InstalledMods()
+	if err != nil {
+		return nil, err
+	}
+	active, err := srv.ActiveMods()
+	if err != nil {
+		return nil, err
+	}
+	positions := map[string]int{}
+	for i, id := range active {
+		positions[id] = i + 1
+	}
+	byID := map[string]server.InstalledMod{}
+	var ids []string
+	for _, m := range installed {
+		byID[m.ID] = m
+		ids = append(ids, m.ID)
+	}
+	for _, id := range active {
+		if _, ok := byID[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	recorded := st.Installs(srv.ModsDir())
+
+	workDir, _ := cmd.Flags().GetString("workdir")
+	client := workshopClient(cmd, workDir)
+	details, err := client.FileDetails(ctx, ids)
+	if errors.Is(err, workshop.ErrOffline) {
+		details = client.CachedFileDetails(ids)
+	} else if err != nil {
+		fmt.Printf("could not look up mod details, outdated mods are not shown: %v\n", err)
+	}
+	versions := map[string]update.Version{}
+	for _, m := range installed {
+		if install, ok := recorded[m.ID]; ok {
+			versions[m.ID] = update.Version{TimeUpdated: install.TimeUpdated, Manifest: install.Manifest}
+		} else if m.ModFile != "" {
+			// the .mod file is written after the download, so it is never
+			// older than the installed version
+			versions[m.ID] = update.Version{TimeUpdated: m.ModTime.Unix()}
+		}
+	}
+	outdated := map[string]bool{}
+	if err == nil {
+		statuses, err := update.Check(ctx, client, versions)
+		if err != nil {
+			fmt.Printf("could not check for updates: %v\n", err)
+		}
+		for _, id := range update.Outdated(statuses) {
+			outdated[id] = true
+		}
+	}
+
+	var rows []modRow
+	for _, id := range ids {
+		m, onDisk := byID[id]
+		row := modRow{ID: id, Position: positions[id]}
+		if install, ok := recorded[id]; ok {
+			row.TimeUpdated = install.TimeUpdated
+			row.Platform = install.Platform
+			row.Title = st.Mods[id].Name
+		}
+		if d, ok := details[id]; ok && d.Title != "" {
+			row.Title = d.Title
+		}
+		if row.Title == "" && m.ModFile != "" {
+			if modFile, err := unpacker.ReadModFile(m.ModFile); err == nil && modFile.Name != "ModName" {
+				row.Title = modFile.Name
+			}
+		}
+		if m.ContentDir != "" {
+			if row.Size, err = server.DirSize(m.ContentDir); err != nil {
+				return nil, err
+			}
+		}
+		switch {
+		case !onDisk:
+			row.Status = modMissing
+		case !m.Complete():
+			row.Status = modOrphaned
+		case outdated[id]:
+			row.Status = modOutdated
+		case row.Position > 0:
+			row.Status = modActivated
+		default:
+			row.Status = modInstalled
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+func writeModRows(w io.Writer, format string, rows []modRow, withTarget bool) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if rows == nil {
+			rows = []modRow{}
+		}
+		return enc.Encode(rows)
+	case "csv":
+		cw := csv.NewWriter(w)
+		if err := cw.Write([]string{"id", "title", "time_updated", "size", "platform", "position", "status", "target"}); err != nil {
+			return err
+		}
+		for _, r := range rows {
+			record := []string{r.ID, r.Title, strconv.FormatInt(r.TimeUpdated, 10), strconv.FormatInt(r.Size, 10),
+				r.Platform, strconv.Itoa(r.Position), r.Status, r.Target}
+			if err := cw.Write(record); err != nil {
+				return err
+			}
+		}
+		cw.Flush()
+		return cw.Error()
+	case "table":
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		header := "ID\tTITLE\tUPDATED\tSIZE\tPLATFORM\tPOSITION\tSTATUS"
+		if withTarget {
+			header += "\tTARGET"
+		}
+		fmt.Fprintln(tw, header)
+		for _, r := range rows {
+			position := "-"
+			if r.Position > 0 {
+				position = strconv.Itoa(r.Position)
+			}
+			platform := r.Platform
+			if platform == "" {
+				platform = "-"
+			}
+			line := fmt.Sprintf("%s\t%s\t%s\t%s\t%s\t%s\t%s", r.ID, r.Title, formatUnix(r.TimeUpdated),
+				formatSize(r.Size), platform, position, r.Status)
+			if withTarget {
+				line += "\t" + r.Target
+			}
+			fmt.Fprintln(tw, line)
+		}
+		return tw.Flush()
+	default:
+		return fmt.Errorf("unknown output format %q", format)
+	}
+}
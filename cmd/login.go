@@ -0,0 +1,132 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/d8x/amm/pkg/credentials"
+	"github.com/d8x/amm/pkg/steam"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.PersistentFlags().String("steam-user", "", "Steam account steamcmd logs in with, default anonymous or $"+credentials.UsernameEnv)
+	rootCmd.PersistentFlags().String("steam-password-file", "", "File with the password of the steam account, readable only by the owner")
+	rootCmd.PersistentFlags().String("steam-guard", "", "Steam Guard code for the first login, asked for on a terminal when not set")
+	rootCmd.AddCommand(loginCMD, logoutCMD)
+}
+
+var loginCMD = &cobra.Command{
+	Use:   "login <username>",
+	Short: "store the password of a steam account in the encrypted credential store",
+	Long: `Store the password of a steam account in the encrypted credential store. The
+password is taken from $` + credentials.PasswordEnv + `, --steam-password-file or stdin, e.g.
+amm login <username> < password-file. The Steam Guard code is not stored, it is
+given with --steam-guard or asked for on a terminal at the first download.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		store, err := credentialStore()
+		if err != nil {
+			fmt.Printf("error while opening credential store: %v\n", err)
+			return
+		}
+		password, err := loginPassword(cmd, args[0], os.Stdin)
+		if err != nil {
+			fmt.Printf("error while reading password: %v\n", err)
+			return
+		}
+		if err := store.Set(args[0], password); err != nil {
+			fmt.Printf("error while storing password: %v\n", err)
+			return
+		}
+		fmt.Printf("password of %s stored\n", args[0])
+	},
+}
+
+// loginPassword returns the password login stores, from the environment, the
+// password file or stdin. A terminal is not read, the password would be
+// echoed.
+func loginPassword(cmd *cobra.Command, username string, stdin *os.File) (string, error) {
+	file, _ := cmd.Flags().GetString("steam-password-file")
+	password, err := credentials.Sources{Env: true, File: file}.Password(username)
+	if err == nil || !errors.Is(err, credentials.ErrNoPassword) {
+		return password, err
+	}
+	if isTerminal(stdin) {
+		return "", fmt.Errorf("no password given, set $%s, pass --steam-password-file or pipe it to stdin, e.g. amm login %s < password-file",
+			credentials.PasswordEnv, username)
+	}
+	password, err = bufio.NewReader(stdin).ReadString('\n')
+	password = strings.TrimRight(password, "\r\n")
+	if password == "" {
+		return "", fmt.Errorf("no password on stdin %v", err)
+	}
+	return password, nil
+}
+
+var logoutCMD = &cobra.Command{
+	Use:   "logout <username>",
+	Short: "remove the password of a steam account from the credential store",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		store, err := credentialStore()
+		if err != nil {
+			fmt.Printf("error while opening credential store: %v\n", err)
+			return
+		}
+		if err := store.Set(args[0], ""); err != nil {
+			fmt.Printf("error while removing password: %v\n", err)
+			return
+		}
+		fmt.Printf("password of %s removed\n", args[0])
+	},
+}
+
+func credentialStore() (*credentials.Store, error) {
+	dir, err := credentials.DefaultStoreDir()
+	if err != nil {
+		return nil, err
+	}
+	return credentials.NewStore(dir), nil
+}
+
+// steamLogin returns the account given with --steam-user or the environment,
+// nil means anonymous. The password is looked up in the environment, the
+// password file and the credential store, in that order.
+func steamLogin(cmd *cobra.Command) *steam.Login {
+	username, _ := cmd.Flags().GetString("steam-user")
+	if username == "" {
+		username = os.Getenv(credentials.UsernameEnv)
+	}
+	if username == "" || username == "anonymous" {
+		return nil
+	}
+	sources := credentials.Sources{Env: true}
+	sources.File, _ = cmd.Flags().GetString("steam-password-file")
+	if store, err := credentialStore(); err == nil {
+		sources.Store = store
+	}
+	login := &steam.Login{Username: username, Password: sources.Password}
+	login.GuardCode, _ = cmd.Flags().GetString("steam-guard")
+	if isTerminal(os.Stdin) {
+		login.PromptGuardCode = promptGuardCode
+	}
+	return login
+}
+
+func promptGuardCode(username string) (string, error) {
+	fmt.Printf("Steam Guard code for %s (empty if none was sent): ", username)
+	code, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && code == "" {
+		return "", errors.New("no Steam Guard code entered")
+	}
+	return strings.TrimSpace(code), nil
+}
+
+func isTerminal(f *os.File) bool {
+	stat, err := f.Stat()
+	return err == nil && stat.Mode()&os.ModeCharDevice != 0
+}
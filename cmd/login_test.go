@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/d8x/amm/pkg/credentials"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+)
+
+// pipe returns a reader which yields input like a redirected stdin.
+func pipe(t *testing.T, input string) *os.File {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		w.WriteString(input)
+		w.Close()
+	}()
+	t.Cleanup(func() { r.Close() })
+	return r
+}
+
+func TestLoginPassword(t *testing.T) {
+	passwordFile := filepath.Join(t.TempDir(), "password")
+	if err := ioutil.WriteFile(passwordFile, []byte("from-file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	// a character device like a terminal
+	terminal, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer terminal.Close()
+	tests := []struct {
+		name    string
+		env     string
+		file    string
+		stdin   *os.File
+		want    string
+		wantErr string
+	}{
+		{"stdin", "", "", pipe(t, "from-stdin\r\n"), "from-stdin", ""},
+		{"password file", "", passwordFile, terminal, "from-file", ""},
+		{"environment", "from-env", passwordFile, terminal, "from-env", ""},
+		{"empty stdin", "", "", pipe(t, ""), "", "no password on stdin"},
+		{"terminal", "", "", terminal, "", "pass --steam-password-file or pipe it to stdin"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prev, ok := os.LookupEnv(credentials.PasswordEnv)
+			os.Setenv(credentials.PasswordEnv, tt.env)
+			defer func() {
+				if ok {
+					os.Setenv(credentials.PasswordEnv, prev)
+				} else {
+					os.Unsetenv(credentials.PasswordEnv)
+				}
+			}()
+			cmd := &cobra.Command{Use: "login"}
+			cmd.Flags().String("steam-password-file", tt.file, "")
+			password, err := loginPassword(cmd, "amm", tt.stdin)
+			if tt.wantErr != "" {
+				if assert.Error(t, err) {
+					assert.Contains(t, err.Error(), tt.wantErr)
+				}
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, password)
+		})
+	}
+}
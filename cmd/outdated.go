@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/d8x/amm/pkg/state"
+	"github.com/d8x/amm/pkg/steam"
+	"github.com/d8x/amm/pkg/update"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(outdatedCMD)
+	outdatedCMD.Flags().StringP("workdir", "w", "amm-workdir", "Working directory")
+	addUpdateSourceFlag(outdatedCMD)
+}
+
+var outdatedCMD = &cobra.Command{
+	Use:   "outdated",
+	Short: "list installed mods with a newer workshop version",
+	Long: `List the mods recorded in the workdir as installed into a server or unpacked
+into a directory which have a newer workshop version. A mod is listed once for
+every target it is installed in.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, cancel := commandContext(cmd)
+		defer cancel()
+		workDir, _ := cmd.Flags().GetString("workdir")
+		steamHandler, err := newSteamHandler(cmd, workDir)
+		if err != nil {
+			fmt.Printf("error when creating steam handler %v\n", err)
+			return
+		}
+		statuses, err := checkUpdates(ctx, cmd, steamHandler)
+		if err != nil {
+			fmt.Printf("error while checking for updates: %v\n", err)
+			return
+		}
+		if len(statuses) == 0 {
+			fmt.Println("no installed mods recorded")
+			return
+		}
+		for _, s := range statuses {
+			switch {
+			case !s.Known:
+				fmt.Printf("%s\tunknown\tinstalled %s\t%s\n", s.ModID, formatUnix(s.Installed.TimeUpdated), s.Target)
+			case s.Outdated:
+				fmt.Printf("%s\toutdated\tinstalled %s, latest %s\t%s\n", s.ModID,
+					formatUnix(s.Installed.TimeUpdated), formatUnix(s.Latest.TimeUpdated), s.Target)
+			default:
+				fmt.Printf("%s\tup to date\tinstalled %s\t%s\n", s.ModID, formatUnix(s.Installed.TimeUpdated), s.Target)
+			}
+		}
+	},
+}
+
+func addUpdateSourceFlag(c *cobra.Command) {
+	c.Flags().String("source", "webapi", "Where to look up the latest mod versions: webapi or steamcmd")
+}
+
+func updateSource(cmd *cobra.Command, steamHandler *steam.SteamHandler) (update.Source, error) {
+	source, _ := cmd.Flags().GetString("source")
+	switch source {
+	case "steamcmd":
+		return steam.NewWorkshopStatusSource(steamHandler), nil
+	case "webapi":
+		workDir, _ := cmd.Flags().GetString("workdir")
+		client := workshopClient(cmd, workDir)
+		// update checks need the current state
+		client.CacheTTL = 0
+		return client, nil
+	default:
+		return nil, fmt.Errorf("unknown update source %q", source)
+	}
+}
+
+// checkUpdates compares the mods recorded in the state of the workdir with
+// their latest published versions, for every target they are installed in.
+func checkUpdates(ctx context.Context, cmd *cobra.Command, steamHandler *steam.SteamHandler) ([]update.Status, error) {
+	source, err := updateSource(cmd, steamHandler)
+	if err != nil {
+		return nil, err
+	}
+	workDir, _ := cmd.Flags().GetString("workdir")
+	db, err := state.Open(workDir)
+	if err != nil {
+		return nil, err
+	}
+	st, err := db.Read()
+	if err != nil {
+		return nil, err
+	}
+	installed := map[string]map[string]update.Version{}
+	for id, m := range st.Mods {
+		for target, i := range m.Installs {
+			if installed[target] == nil {
+				installed[target] = map[string]update.Version{}
+			}
+			installed[target][id] = update.Version{TimeUpdated: i.TimeUpdated, Manifest: i.Manifest}
+		}
+	}
+	return update.CheckTargets(ctx, source, installed)
+}
+
+func formatUnix(sec int64) string {
+	if sec == 0 {
+		return "-"
+	}
+	return time.Unix(sec, 0).Format(time.RFC3339)
+}
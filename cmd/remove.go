@@ -0,0 +1,137 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/d8x/amm/pkg/deps"
+	"github.com/d8x/amm/pkg/server"
+	"github.com/d8x/amm/pkg/unpacker"
+	"github.com/d8x/amm/pkg/workshop"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(removeCMD)
+	removeCMD.Flags().StringP("server-dir", "s", "", "ARK server directory")
+	removeCMD.Flags().StringP("workdir", "w", "amm-workdir", "Working directory")
+	removeCMD.Flags().Bool("force", false, "Remove mods even when other installed mods require them")
+	removeCMD.Flags().Bool("dry-run", false, "Only print what would be removed")
+	removeCMD.MarkFlagRequired("server-dir")
+}
+
+var removeCMD = &cobra.Command{
+	Use:   "remove <mod>...",
+	Short: "remove mods from a server",
+	Long: `Remove mods from a server: the content folder, the .mod file and the
+ActiveMods entry of every mod are deleted. Mods other installed mods require
+are only removed with --force.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, cancel := commandContext(cmd)
+		defer cancel()
+		serverDir, _ := cmd.Flags().GetString("server-dir")
+		workDir, _ := cmd.Flags().GetString("workdir")
+		force, _ := cmd.Flags().GetBool("force")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		srv, err := openServer(serverDir)
+		if err != nil {
+			fmt.Printf("error with server dir %s: %v\n", serverDir, err)
+			return
+		}
+		mods, err := workshop.ParseRefs(args)
+		if err != nil {
+			fmt.Printf("error while parsing mods: %v\n", err)
+			return
+		}
+		remaining, err := remainingMods(srv, mods)
+		if err != nil {
+			fmt.Printf("error while reading installed mods: %v\n", err)
+			return
+		}
+		if !force && len(remaining) > 0 {
+			required, err := workshopClient(cmd, workDir).RequiredItems(ctx, remaining)
+			if err != nil {
+				fmt.Printf("error while checking which mods require the removed ones, use --force to remove them anyway: %v\n", err)
+				return
+			}
+			graph := &deps.Graph{Roots: remaining, Requires: required}
+			blocked := false
+			for _, id := range mods {
+				if dependents := graph.Dependents(id); len(dependents) > 0 {
+					fmt.Printf("mod %s is required by %s\n", id, strings.Join(dependents, ", "))
+					blocked = true
+				}
+			}
+			if blocked {
+				fmt.Println("nothing removed, use --force to remove required mods")
+				return
+			}
+		}
+		active, err := srv.ActiveMods()
+		if err != nil {
+			fmt.Printf("error while reading ActiveMods: %v\n", err)
+			return
+		}
+		activeMods := map[string]bool{}
+		for _, id := range active {
+			activeMods[id] = true
+		}
+		var removed []string
+		for _, id := range mods {
+			paths := srv.ModPaths(id)
+			if len(paths) == 0 && !activeMods[id] {
+				fmt.Printf("mod %s is not installed\n", id)
+				continue
+			}
+			if dryRun {
+				for _, location := range paths {
+					fmt.Printf("would remove %s\n", location)
+				}
+				if activeMods[id] {
+					fmt.Printf("would remove %s from ActiveMods\n", id)
+				}
+				continue
+			}
+			if err := srv.RemoveMod(id); err != nil {
+				fmt.Printf("error while removing mod %s: %v\n", id, err)
+				continue
+			}
+			if err := unpacker.RemoveManifest(srv.ModsDir(), id); err != nil {
+				fmt.Printf("could not remove manifest of mod %s: %v\n", id, err)
+			}
+			fmt.Printf("mod removed %s\n", id)
+			removed = append(removed, id)
+		}
+		forgetInstalls(workDir, srv.ModsDir(), removed)
+	},
+}
+
+// remainingMods returns the mods installed in or activated on the server,
+// except the given ones.
+func remainingMods(srv *server.Server, except []string) ([]string, error) {
+	skip := map[string]bool{}
+	for _, id := range except {
+		skip[id] = true
+	}
+	installed, err := srv.InstalledMods()
+	if err != nil {
+		return nil, err
+	}
+	active, err := srv.ActiveMods()
+	if err != nil {
+		return nil, err
+	}
+	ids := active
+	for _, m := range installed {
+		ids = append(ids, m.ID)
+	}
+	var remaining []string
+	for _, id := range ids {
+		if !skip[id] {
+			skip[id] = true
+			remaining = append(remaining, id)
+		}
+	}
+	return remaining, nil
+}
@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/d8x/amm/pkg/server"
+	"github.com/d8x/amm/pkg/snapshot"
+	"github.com/d8x/amm/pkg/unpacker"
+	"github.com/d8x/amm/pkg/workshop"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(rollbackCMD)
+	rollbackCMD.Flags().StringP("workdir", "w", "amm-workdir", "Working directory")
+	rollbackCMD.Flags().String("to", "", "Snapshot to restore (default the newest)")
+	rollbackCMD.Flags().StringP("server-dir", "s", "", "Only restore snapshots taken in this ARK server")
+}
+
+var rollbackCMD = &cobra.Command{
+	Use:   "rollback <mod>",
+	Short: "restore a snapshot of a mod taken before it was updated",
+	Long: `Restore a snapshot of a mod taken before install or update overwrote it.
+The snapshot is put back where it was taken, replacing the installed version.
+The replaced version can be installed again from the download cache.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		workDir, _ := cmd.Flags().GetString("workdir")
+		to, _ := cmd.Flags().GetString("to")
+		serverDir, _ := cmd.Flags().GetString("server-dir")
+		ids, err := workshop.ParseRefs(args)
+		if err != nil || len(ids) != 1 {
+			fmt.Printf("error: invalid mod %s\n", args[0])
+			return
+		}
+		modID := ids[0]
+		target := ""
+		if serverDir != "" {
+			srv, err := server.New(serverDir)
+			if err != nil {
+				fmt.Printf("error with server dir %s: %v\n", serverDir, err)
+				return
+			}
+			target = srv.ModsDir()
+		}
+		store, err := snapshotStore(workDir)
+		if err != nil {
+			fmt.Printf("error while opening snapshots: %v\n", err)
+			return
+		}
+		snap, err := selectSnapshot(store, modID, to, target)
+		if err != nil {
+			fmt.Printf("error while looking up snapshot of mod %s: %v\n", modID, err)
+			return
+		}
+		if _, err := unpacker.Recover(snap.Target); err != nil {
+			fmt.Printf("error while recovering interrupted installs in %s: %v\n", snap.Target, err)
+			return
+		}
+		if err := snap.Restore(); err != nil {
+			fmt.Printf("error while restoring snapshot %s of mod %s: %v\n", snap.ID, modID, err)
+			return
+		}
+		if err := unpacker.WriteManifest(snap.Target, modID); err != nil {
+			fmt.Printf("could not update manifest of mod %s: %v\n", modID, err)
+		}
+		fmt.Printf("mod %s rolled back to snapshot %s (updated %s) in %s\n", modID, snap.ID, formatUnix(snap.TimeUpdated), snap.Target)
+		recordRollback(workDir, snap)
+	},
+}
+
+// selectSnapshot returns the snapshot with the id or, without one, the
+// newest snapshot. A non empty target only matches snapshots taken there.
+func selectSnapshot(store *snapshot.Store, modID, id, target string) (*snapshot.Snapshot, error) {
+	if id != "" {
+		snap, err := store.Get(modID, id)
+		if err != nil {
+			return nil, err
+		}
+		if target != "" && filepath.Clean(snap.Target) != filepath.Clean(target) {
+			return nil, fmt.Errorf("snapshot %s was taken in %s", id, snap.Target)
+		}
+		return snap, nil
+	}
+	snaps, err := store.List(modID)
+	if err != nil {
+		return nil, err
+	}
+	for _, snap := range snaps {
+		if target == "" || filepath.Clean(snap.Target) == filepath.Clean(target) {
+			return snap, nil
+		}
+	}
+	return nil, snapshot.ErrNoSnapshot
+}
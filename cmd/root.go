@@ -6,10 +6,15 @@ import (
 	"os"
 )
 
+// Version is set at build time with -ldflags "-X github.com/d8x/amm/cmd.Version=<version>".
+var Version = "dev"
+
 var rootCmd = &cobra.Command{
-	Use:   "amm",
-	Short: "Amm is Ark mods manager",
+	Use:     "amm",
+	Short:   "Amm is Ark mods manager",
+	Version: Version,
 
+	PersistentPreRunE: loadConfig,
 	Run: func(cmd *cobra.Command, args []string) {
 		if len(args) == 0 {
 			cmd.Help()
@@ -17,8 +22,32 @@ var rootCmd = &cobra.Command{
 	},
 }
 
+func init() {
+	rootCmd.PersistentFlags().String("config", "", "Configuration file read after the system and user configuration")
+	rootCmd.PersistentFlags().Duration("timeout", 0, "Abort the command after this duration, e.g. 30m")
+	rootCmd.PersistentFlags().Bool("offline", false, "Use only the local cache, never run steamcmd or ask the Steam Web API")
+	rootCmd.PersistentFlags().String("min-free", "1G", "Space downloads, unpacks and installs leave free on every filesystem, e.g. 512M or 20G")
+}
+
+func isOffline(cmd *cobra.Command) bool {
+	offline, _ := cmd.Flags().GetBool("offline")
+	return offline
+}
+
+// minFree returns the --min-free safety margin in bytes.
+func minFree(cmd *cobra.Command) (int64, error) {
+	value, _ := cmd.Flags().GetString("min-free")
+	size, err := parseSize(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid --min-free %q: %w", value, err)
+	}
+	return size, nil
+}
+
 func Execute() {
-	if err := rootCmd.Execute(); err != nil {
+	ctx, cancel := signalContext()
+	defer cancel()
+	if err := rootCmd.ExecuteContext(ctx); err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
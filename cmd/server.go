@@ -0,0 +1,175 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/d8x/amm/pkg/steam"
+	"github.com/d8x/amm/pkg/vdf"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(serverCMD)
+	serverCMD.PersistentFlags().StringP("dir", "d", "", "ARK server directory")
+	serverCMD.PersistentFlags().String("beta", "", "Server branch, default public or the installed branch")
+	serverCMD.PersistentFlags().StringP("workdir", "w", "amm-workdir", "Working directory")
+	serverCMD.PersistentFlags().String("platform", "", "Server platform: windows or linux (default host platform)")
+	serverCMD.MarkPersistentFlagRequired("dir")
+	serverUpdateCMD.Flags().Bool("force", false, "Run app_update even if the installed build is the latest")
+	serverCMD.AddCommand(serverInstallCMD, serverUpdateCMD, serverValidateCMD, serverStatusCMD)
+}
+
+var serverCMD = &cobra.Command{
+	Use:   "server",
+	Short: "install and update the ARK dedicated server (app " + steam.ServerAppID + ")",
+}
+
+var serverInstallCMD = &cobra.Command{
+	Use:   "install",
+	Short: "install the ARK server into --dir",
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, cancel := commandContext(cmd)
+		defer cancel()
+		opts, steamHandler, err := serverOptions(cmd)
+		if err != nil {
+			fmt.Printf("error with server options: %v\n", err)
+			return
+		}
+		if state, err := steam.ReadServerState(opts.Dir); err == nil {
+			fmt.Printf("server build %s is already installed in %s, updating it\n", state.BuildID, opts.Dir)
+		}
+		runServerUpdate(ctx, cmd, steamHandler, opts)
+	},
+}
+
+var serverUpdateCMD = &cobra.Command{
+	Use:   "update",
+	Short: "update the ARK server in --dir when a newer build is available",
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, cancel := commandContext(cmd)
+		defer cancel()
+		opts, steamHandler, err := serverOptions(cmd)
+		if err != nil {
+			fmt.Printf("error with server options: %v\n", err)
+			return
+		}
+		status, err := serverStatus(ctx, steamHandler, opts)
+		if err != nil {
+			fmt.Printf("error while checking server: %v\n", err)
+			return
+		}
+		if force, _ := cmd.Flags().GetBool("force"); !force && !status.updateAvailable() {
+			fmt.Printf("server is up to date, build %s on %s\n", status.installed.BuildID, branchName(opts.Beta))
+			return
+		}
+		runServerUpdate(ctx, cmd, steamHandler, opts)
+	},
+}
+
+var serverValidateCMD = &cobra.Command{
+	Use:   "validate",
+	Short: "let steamcmd check the ARK server files in --dir and repair broken ones",
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, cancel := commandContext(cmd)
+		defer cancel()
+		opts, steamHandler, err := serverOptions(cmd)
+		if err != nil {
+			fmt.Printf("error with server options: %v\n", err)
+			return
+		}
+		opts.Validate = true
+		runServerUpdate(ctx, cmd, steamHandler, opts)
+	},
+}
+
+var serverStatusCMD = &cobra.Command{
+	Use:   "status",
+	Short: "show the installed server build and whether an update is available",
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, cancel := commandContext(cmd)
+		defer cancel()
+		opts, steamHandler, err := serverOptions(cmd)
+		if err != nil {
+			fmt.Printf("error with server options: %v\n", err)
+			return
+		}
+		status, err := serverStatus(ctx, steamHandler, opts)
+		if err != nil {
+			fmt.Printf("error while checking server: %v\n", err)
+			return
+		}
+		fmt.Printf("dir\t%s\nbranch\t%s\ninstalled\t%s (%s)\nlatest\t%s\n", opts.Dir, branchName(opts.Beta),
+			status.installed.BuildID, formatUnix(status.installed.LastUpdated), status.latest)
+		if status.updateAvailable() {
+			fmt.Println("update available")
+		} else {
+			fmt.Println("up to date")
+		}
+	},
+}
+
+func serverOptions(cmd *cobra.Command) (steam.ServerOptions, *steam.SteamHandler, error) {
+	opts := steam.ServerOptions{}
+	opts.Dir, _ = cmd.Flags().GetString("dir")
+	opts.Beta, _ = cmd.Flags().GetString("beta")
+	var err error
+	if opts.Platform, err = downloadPlatform(cmd, ""); err != nil {
+		return opts, nil, err
+	}
+	if opts.Beta == "" {
+		if state, err := steam.ReadServerState(opts.Dir); err == nil {
+			opts.Beta = state.BetaKey
+		}
+	}
+	workDir, _ := cmd.Flags().GetString("workdir")
+	steamHandler, err := newSteamHandler(cmd, workDir)
+	return opts, steamHandler, err
+}
+
+type serverUpdateStatus struct {
+	installed *vdf.AppState
+	latest    string
+}
+
+func (s serverUpdateStatus) updateAvailable() bool {
+	return s.installed.BuildID != s.latest
+}
+
+func serverStatus(ctx context.Context, steamHandler *steam.SteamHandler, opts steam.ServerOptions) (serverUpdateStatus, error) {
+	installed, err := steam.ReadServerState(opts.Dir)
+	if err != nil {
+		return serverUpdateStatus{}, err
+	}
+	latest, err := steamHandler.LatestServerBuild(ctx, opts.Beta, opts.Platform)
+	if err != nil {
+		return serverUpdateStatus{}, err
+	}
+	return serverUpdateStatus{installed: installed, latest: latest}, nil
+}
+
+func runServerUpdate(ctx context.Context, cmd *cobra.Command, steamHandler *steam.SteamHandler, opts steam.ServerOptions) {
+	before, _ := steam.ReadServerState(opts.Dir)
+	state, err := steamHandler.UpdateServer(ctx, opts)
+	if err != nil {
+		fmt.Printf("error while updating server: %v\n", err)
+		return
+	}
+	workDir, _ := cmd.Flags().GetString("workdir")
+	recordServer(workDir, opts, state.BuildID, branchName(state.BetaKey))
+	switch {
+	case before == nil:
+		fmt.Printf("server build %s installed in %s\n", state.BuildID, opts.Dir)
+	case before.BuildID != state.BuildID:
+		fmt.Printf("server updated from build %s to %s\n", before.BuildID, state.BuildID)
+	default:
+		fmt.Printf("server is at build %s\n", state.BuildID)
+	}
+}
+
+func branchName(beta string) string {
+	if beta == "" {
+		return "public"
+	}
+	return beta
+}
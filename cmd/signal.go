@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/spf13/cobra"
+)
+
+// signalContext returns a context which is cancelled on the first SIGINT or
+// SIGTERM, so running operations can stop and clean up after themselves.
+// A second signal exits right away.
+func signalContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		fmt.Fprintf(os.Stderr, "received %v, stopping\n", sig)
+		cancel()
+		sig = <-signals
+		fmt.Fprintf(os.Stderr, "received %v again, exiting\n", sig)
+		os.Exit(1)
+	}()
+	return ctx, cancel
+}
+
+// commandContext returns the context of the running command bounded by the
+// global --timeout flag.
+func commandContext(cmd *cobra.Command) (context.Context, context.CancelFunc) {
+	ctx := cmd.Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	timeout, _ := cmd.Flags().GetDuration("timeout")
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
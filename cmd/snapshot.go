@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/d8x/amm/pkg/snapshot"
+	"github.com/d8x/amm/pkg/state"
+)
+
+// snapshotStore opens the snapshots of the workdir, the snapshot.keep
+// setting limits how many are kept per mod.
+func snapshotStore(workDir string) (*snapshot.Store, error) {
+	return snapshot.New(filepath.Join(workDir, "snapshots"), cfg.SnapshotKeep)
+}
+
+// takeSnapshot keeps the version of the mod installed in target before it
+// is overwritten with the version with the given manifest. Nothing is taken
+// when that version is installed already. Failing to take it does not fail
+// the install.
+func takeSnapshot(workDir, target, modID, manifest string) {
+	if abs, err := filepath.Abs(target); err == nil {
+		target = abs
+	}
+	version := snapshot.Version{}
+	db, err := state.Open(workDir)
+	if err == nil {
+		var st *state.State
+		if st, err = db.Read(); err == nil {
+			if install, ok := st.Installs(target)[modID]; ok {
+				if manifest != "" && install.Manifest == manifest {
+					return
+				}
+				version = snapshot.Version{Manifest: install.Manifest, TimeUpdated: install.TimeUpdated, Platform: install.Platform}
+			}
+		}
+	}
+	if err != nil {
+		fmt.Printf("could not read state: %v\n", err)
+	}
+	if version.TimeUpdated == 0 {
+		// not installed by amm, the .mod file is written after the download
+		if stat, err := os.Stat(filepath.Join(target, modID+".mod")); err == nil {
+			version.TimeUpdated = stat.ModTime().Unix()
+		}
+	}
+	store, err := snapshotStore(workDir)
+	if err != nil {
+		fmt.Printf("could not open snapshots: %v\n", err)
+		return
+	}
+	snap, err := store.Take(modID, target, version)
+	if errors.Is(err, snapshot.ErrNotInstalled) {
+		return
+	}
+	if err != nil {
+		fmt.Printf("could not snapshot mod %s: %v\n", modID, err)
+		return
+	}
+	fmt.Printf("snapshot %s of mod %s taken\n", snap.ID, modID)
+}
@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"github.com/d8x/amm/pkg/diskspace"
+	"github.com/d8x/amm/pkg/steam"
+	"github.com/d8x/amm/pkg/workshop"
+	"github.com/spf13/cobra"
+)
+
+// checkSpace estimates the space downloading the mods into the workdir and
+// unpacking or installing them into target takes and refuses when less than
+// --min-free would be left. A download is kept twice, in the steamcmd
+// instance and in the cache. Mods which are cached take their unpacked size,
+// the others at least their workshop file size. An empty target skips the
+// unpack.
+func checkSpace(cmd *cobra.Command, steamHandler *steam.SteamHandler, mods []string,
+	details map[string]*workshop.FileDetails, platform, target string, install bool) error {
+	margin, err := minFree(cmd)
+	if err != nil {
+		return err
+	}
+	workDir, _ := cmd.Flags().GetString("workdir")
+	cachePlatform := platform
+	if cachePlatform == "" {
+		cachePlatform = steam.HostPlatform()
+	}
+	var download, unpacked int64
+	for _, id := range mods {
+		var fileSize int64
+		manifest := ""
+		if d, ok := details[id]; ok {
+			fileSize, manifest = d.FileSize, d.Manifest
+		}
+		entry, err := steamHandler.Cache().Lookup(id, manifest, cachePlatform)
+		if err != nil {
+			download += 2 * fileSize
+			unpacked += fileSize
+			continue
+		}
+		if target == "" {
+			continue
+		}
+		modUnpacker, err := newModUnpacker(cmd, entry.Path(), target)
+		if err != nil {
+			return err
+		}
+		modUnpacker.Platform = platform
+		size, err := modUnpacker.UnpackSize()
+		if install {
+			size, err = modUnpacker.InstallSize()
+		}
+		if err != nil {
+			return err
+		}
+		unpacked += size
+	}
+	needs := []diskspace.Need{{Path: workDir, Bytes: download}}
+	if target != "" {
+		needs = append(needs, diskspace.Need{Path: target, Bytes: unpacked})
+	}
+	return diskspace.Check(needs, margin)
+}
@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/d8x/amm/pkg/snapshot"
+	"github.com/d8x/amm/pkg/state"
+	"github.com/d8x/amm/pkg/steam"
+	"github.com/d8x/amm/pkg/workshop"
+)
+
+// recordInstall adds the mod installed or unpacked into target to the state
+// of the workdir. Failing to record it does not fail the install.
+func recordInstall(workDir, target string, result steam.DownloadResult, details map[string]*workshop.FileDetails) {
+	db, err := state.Open(workDir)
+	if err != nil {
+		fmt.Printf("could not open state: %v\n", err)
+		return
+	}
+	if abs, err := filepath.Abs(target); err == nil {
+		target = abs
+	}
+	name := ""
+	if d, ok := details[result.ModID]; ok {
+		name = d.Title
+	}
+	err = db.Update(func(s *state.State) error {
+		s.SetInstall(result.ModID, name, state.Install{
+			Target:      target,
+			Manifest:    result.Item.Manifest,
+			TimeUpdated: result.Item.TimeUpdated,
+			ContentHash: result.ContentHash,
+			Platform:    result.Platform,
+			InstalledAt: time.Now(),
+			AmmVersion:  Version,
+		})
+		return nil
+	})
+	if err != nil {
+		fmt.Printf("could not record mod %s in state: %v\n", result.ModID, err)
+	}
+}
+
+// forgetInstalls drops the mods removed from target from the state of the workdir.
+func forgetInstalls(workDir, target string, modIDs []string) {
+	if len(modIDs) == 0 {
+		return
+	}
+	db, err := state.Open(workDir)
+	if err != nil {
+		fmt.Printf("could not open state: %v\n", err)
+		return
+	}
+	if abs, err := filepath.Abs(target); err == nil {
+		target = abs
+	}
+	err = db.Update(func(s *state.State) error {
+		for _, id := range modIDs {
+			s.RemoveInstall(id, target)
+		}
+		return nil
+	})
+	if err != nil {
+		fmt.Printf("could not update state: %v\n", err)
+	}
+}
+
+// recordRollback records the version of the restored snapshot as installed.
+func recordRollback(workDir string, snap *snapshot.Snapshot) {
+	db, err := state.Open(workDir)
+	if err != nil {
+		fmt.Printf("could not open state: %v\n", err)
+		return
+	}
+	err = db.Update(func(s *state.State) error {
+		s.SetInstall(snap.ModID, "", state.Install{
+			Target:      snap.Target,
+			Manifest:    snap.Manifest,
+			TimeUpdated: snap.TimeUpdated,
+			Platform:    snap.Platform,
+			InstalledAt: time.Now(),
+			AmmVersion:  Version,
+		})
+		return nil
+	})
+	if err != nil {
+		fmt.Printf("could not record mod %s in state: %v\n", snap.ModID, err)
+	}
+}
+
+// recordServer adds the server build installed by steamcmd to the state of the workdir.
+func recordServer(workDir string, opts steam.ServerOptions, buildID, branch string) {
+	db, err := state.Open(workDir)
+	if err != nil {
+		fmt.Printf("could not open state: %v\n", err)
+		return
+	}
+	dir, err := filepath.Abs(opts.Dir)
+	if err != nil {
+		dir = opts.Dir
+	}
+	platform := opts.Platform
+	if platform == "" {
+		platform = steam.HostPlatform()
+	}
+	err = db.Update(func(s *state.State) error {
+		s.Servers[dir] = &state.Server{
+			Dir:      dir,
+			BuildID:  buildID,
+			Branch:   branch,
+			Platform: platform,
+			Updated:  time.Now(),
+		}
+		return nil
+	})
+	if err != nil {
+		fmt.Printf("could not record server in state: %v\n", err)
+	}
+}
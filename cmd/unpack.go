@@ -8,12 +8,36 @@ import (
 
 func init() {
 	rootCmd.AddCommand(unpackCMD)
+	unpackCMD.Flags().StringP("output", "o", "amm-unpacked", "Directory the mods are unpacked to")
+	unpackCMD.Flags().Bool("incremental", false, "Only unpack the archives which changed since the last incremental unpack")
 }
 
 var unpackCMD = &cobra.Command{
-	Use:   "unpack",
+	Use:   "unpack <raw mod dir>...",
 	Short: "unpack an asset",
 	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("unpack")
+		ctx, cancel := commandContext(cmd)
+		defer cancel()
+		output, _ := cmd.Flags().GetString("output")
+		if !cmd.Flags().Changed("output") {
+			output = cfg.UnpackDir
+		}
+		incremental, _ := cmd.Flags().GetBool("incremental")
+		for _, rawModDir := range args {
+			modUnpacker, err := newModUnpacker(cmd, rawModDir, output)
+			if err != nil {
+				fmt.Printf("error when creating unpacker for %s: %v\n", rawModDir, err)
+				continue
+			}
+			modUnpacker.Incremental = incremental
+			if err := modUnpacker.Unpack(ctx); err != nil {
+				fmt.Printf("error while unpacking %s: %v\n", rawModDir, err)
+				if ctx.Err() != nil {
+					return
+				}
+				continue
+			}
+			fmt.Printf("mod unpacked %s\n", rawModDir)
+		}
 	},
 }
@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/d8x/amm/pkg/server"
+	"github.com/d8x/amm/pkg/steam"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(updateCMD)
+	updateCMD.Flags().StringP("workdir", "w", "amm-workdir", "Working directory")
+	updateCMD.Flags().IntP("concurrency", "c", 1, "Number of parallel steamcmd downloads")
+	updateCMD.Flags().Bool("incremental", false, "Only unpack the archives which changed since the last incremental unpack, servers are always installed in full")
+	addPlatformFlag(updateCMD)
+	addUpdateSourceFlag(updateCMD)
+}
+
+var updateCMD = &cobra.Command{
+	Use:   "update",
+	Short: "update the outdated mods where they were installed or unpacked",
+	Long: `Update the mods recorded in the workdir which have a newer workshop version.
+Mods installed into a server are installed into its Mods folder again, mods
+unpacked into a directory are unpacked there again. --incremental only applies
+to directories: an install stages a complete copy of the mod next to the
+installed one and swaps it in, so the server never sees a mix of versions.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, cancel := commandContext(cmd)
+		defer cancel()
+		workDir, _ := cmd.Flags().GetString("workdir")
+		steamHandler, err := newSteamHandler(cmd, workDir)
+		if err != nil {
+			fmt.Printf("error when creating steam handler %v\n", err)
+			return
+		}
+		statuses, err := checkUpdates(ctx, cmd, steamHandler)
+		if err != nil {
+			fmt.Printf("error while checking for updates: %v\n", err)
+			return
+		}
+		outdated := map[string][]string{}
+		var targets []string
+		for _, s := range statuses {
+			if !s.Outdated {
+				continue
+			}
+			if _, ok := outdated[s.Target]; !ok {
+				targets = append(targets, s.Target)
+			}
+			outdated[s.Target] = append(outdated[s.Target], s.ModID)
+		}
+		if len(targets) == 0 {
+			fmt.Println("all mods are up to date")
+			return
+		}
+		for _, target := range targets {
+			updateTarget(ctx, cmd, steamHandler, target, outdated[target])
+			if ctx.Err() != nil {
+				return
+			}
+		}
+	},
+}
+
+// updateTarget installs the mods into the server whose Mods folder is
+// target again. Other targets are directories the mods are unpacked to.
+func updateTarget(ctx context.Context, cmd *cobra.Command, steamHandler *steam.SteamHandler, target string, mods []string) {
+	srv, err := server.FromModsDir(target)
+	if err != nil {
+		fmt.Printf("updating %d mods unpacked to %s\n", len(mods), target)
+		downloadModsTo(ctx, cmd, steamHandler, mods, target)
+		return
+	}
+	fmt.Printf("updating %d mods installed in server %s\n", len(mods), srv.Dir())
+	if incremental, _ := cmd.Flags().GetBool("incremental"); incremental {
+		fmt.Println("--incremental does not apply to servers, the mods are installed in full")
+	}
+	if srv, err = openServer(srv.Dir()); err != nil {
+		fmt.Printf("error with server dir %s: %v\n", target, err)
+		return
+	}
+	workDir, _ := cmd.Flags().GetString("workdir")
+	mods, details := checkAvailable(ctx, workshopClient(cmd, workDir), mods)
+	installMods(ctx, cmd, steamHandler, srv, mods, details)
+}
@@ -0,0 +1,158 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/d8x/amm/pkg/cache"
+	"github.com/d8x/amm/pkg/server"
+	"github.com/d8x/amm/pkg/state"
+	"github.com/d8x/amm/pkg/steam"
+	"github.com/d8x/amm/pkg/unpacker"
+	"github.com/d8x/amm/pkg/workshop"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(verifyCMD)
+	verifyCMD.Flags().StringP("server-dir", "s", "", "Verify the mods installed in this ARK server instead of the unpack dir")
+	verifyCMD.Flags().String("unpack-dir", "amm-unpacked", "Directory the mods were unpacked to")
+	verifyCMD.Flags().StringP("workdir", "w", "amm-workdir", "Working directory")
+	verifyCMD.Flags().Bool("repair", false, "Unpack the broken mods again from the cache")
+}
+
+var verifyCMD = &cobra.Command{
+	Use:   "verify [<mod>...]",
+	Short: "check unpacked or installed mods against their manifest",
+	Long: `Check unpacked or installed mods against the manifest written when they were
+unpacked, reporting missing, extra and modified files. Without mods every mod
+with a manifest is checked. With --repair the broken mods are unpacked again
+from the cached download.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, cancel := commandContext(cmd)
+		defer cancel()
+		serverDir, _ := cmd.Flags().GetString("server-dir")
+		root, _ := cmd.Flags().GetString("unpack-dir")
+		repair, _ := cmd.Flags().GetBool("repair")
+		var srv *server.Server
+		if serverDir != "" {
+			var err error
+			if srv, err = openServer(serverDir); err != nil {
+				fmt.Printf("error with server dir %s: %v\n", serverDir, err)
+				return
+			}
+			root = srv.ModsDir()
+		}
+		mods, err := workshop.ParseRefs(args)
+		if err != nil {
+			fmt.Printf("error while parsing mods: %v\n", err)
+			return
+		}
+		if len(mods) == 0 {
+			if mods, err = unpacker.ManifestIDs(root); err != nil {
+				fmt.Printf("error while listing manifests: %v\n", err)
+				return
+			}
+		}
+		broken := map[string][]unpacker.Problem{}
+		var brokenIDs []string
+		for _, id := range mods {
+			problems, err := unpacker.Verify(root, id)
+			if errors.Is(err, unpacker.ErrNoManifest) {
+				fmt.Printf("mod %s has no manifest, skipped\n", id)
+				continue
+			}
+			if err != nil {
+				fmt.Printf("error while verifying mod %s: %v\n", id, err)
+				continue
+			}
+			if len(problems) == 0 {
+				fmt.Printf("mod %s ok\n", id)
+				continue
+			}
+			for _, p := range problems {
+				fmt.Printf("mod %s: %s %s\n", id, p.Kind, p.Path)
+			}
+			broken[id] = problems
+			brokenIDs = append(brokenIDs, id)
+		}
+		if len(brokenIDs) == 0 {
+			return
+		}
+		if !repair {
+			fmt.Printf("%d of %d mods broken, run with --repair to unpack them again\n", len(brokenIDs), len(mods))
+			return
+		}
+		for _, id := range brokenIDs {
+			if err := repairMod(ctx, cmd, srv, root, id, broken[id]); err != nil {
+				fmt.Printf("error while repairing mod %s: %v\n", id, err)
+				if ctx.Err() != nil {
+					return
+				}
+				continue
+			}
+			fmt.Printf("mod repaired %s\n", id)
+		}
+	},
+}
+
+// repairMod unpacks the cached version of the mod recorded for root again,
+// installing it when srv is set. The latest cached version is used when
+// none is recorded. An unpack is written over the existing files, so the
+// extra files are deleted afterwards.
+func repairMod(ctx context.Context, cmd *cobra.Command, srv *server.Server, root, modID string, problems []unpacker.Problem) error {
+	workDir, _ := cmd.Flags().GetString("workdir")
+	modCache, err := openCache(cmd)
+	if err != nil {
+		return err
+	}
+	platform := steam.HostPlatform()
+	if srv != nil {
+		platform = srv.Platform()
+	}
+	manifest := ""
+	if db, err := state.Open(workDir); err == nil {
+		if st, err := db.Read(); err == nil {
+			target := root
+			if abs, err := filepath.Abs(root); err == nil {
+				target = abs
+			}
+			if install, ok := st.Installs(target)[modID]; ok {
+				manifest = install.Manifest
+				if install.Platform != "" {
+					platform = install.Platform
+				}
+			}
+		}
+	}
+	entry, err := modCache.Lookup(modID, manifest, platform)
+	if errors.Is(err, cache.ErrNotCached) {
+		entry, err = modCache.Latest(modID, platform)
+	}
+	if err != nil {
+		return err
+	}
+	modUnpacker, err := newModUnpacker(cmd, entry.Path(), root)
+	if err != nil {
+		return err
+	}
+	modUnpacker.Platform = platform
+	if srv != nil {
+		return modUnpacker.Install(ctx, root)
+	}
+	if err := modUnpacker.Unpack(ctx); err != nil {
+		return err
+	}
+	for _, p := range problems {
+		if p.Kind != unpacker.FileExtra {
+			continue
+		}
+		if err := os.Remove(filepath.Join(root, modID, filepath.FromSlash(p.Path))); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return unpacker.WriteManifest(root, modID)
+}
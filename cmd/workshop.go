@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	"github.com/d8x/amm/pkg/workshop"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.PersistentFlags().String("steam-api", workshop.DefaultBaseURL, "Base url of the Steam Web API")
+}
+
+// workshopClient creates a web api client caching its responses in the workdir.
+func workshopClient(cmd *cobra.Command, workDir string) *workshop.Client {
+	baseURL, _ := cmd.Flags().GetString("steam-api")
+	client := workshop.NewClient(baseURL)
+	client.CacheDir = filepath.Join(workDir, ".cache", "workshop")
+	client.Offline = isOffline(cmd)
+	return client
+}
+
+// resolveMods expands the mod references given on the command line into
+// mod ids, see workshop.Client.Resolve.
+func resolveMods(ctx context.Context, cmd *cobra.Command, workDir string, refs []string) ([]string, error) {
+	return workshopClient(cmd, workDir).Resolve(ctx, refs)
+}
+
+// checkAvailable drops the mods which are banned or were removed from the
+// workshop. When steam cannot be asked all mods are kept.
+func checkAvailable(ctx context.Context, client *workshop.Client, mods []string) ([]string, map[string]*workshop.FileDetails) {
+	details, err := client.FileDetails(ctx, mods)
+	if errors.Is(err, workshop.ErrOffline) {
+		// offline the cached details pin the versions, the other mods use
+		// their newest cached version
+		details = client.CachedFileDetails(mods)
+	} else if err != nil {
+		fmt.Printf("could not look up mod details, skipping checks: %v\n", err)
+		return mods, nil
+	}
+	var available []string
+	for _, id := range mods {
+		d, ok := details[id]
+		if !ok {
+			available = append(available, id)
+			continue
+		}
+		if err := d.Check(); err != nil {
+			fmt.Printf("refusing mod %s: %v\n", id, err)
+			continue
+		}
+		available = append(available, id)
+	}
+	return available, details
+}
+
+// currentManifests returns the current workshop manifest of each mod, the
+// scheduler uses them to skip downloads of cached versions.
+func currentManifests(details map[string]*workshop.FileDetails) map[string]string {
+	manifests := map[string]string{}
+	for id, d := range details {
+		manifests[id] = d.Manifest
+	}
+	return manifests
+}
@@ -6,5 +6,6 @@ require (
 	github.com/magiconair/properties v1.8.1
 	github.com/otiai10/copy v1.2.0
 	github.com/spf13/cobra v1.1.1
+	github.com/spf13/pflag v1.0.5
 	github.com/stretchr/testify v1.3.0
 )
@@ -0,0 +1,160 @@
+package cache
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Export writes the entries as a gzipped tar with the cache layout, so it can
+// be imported into the cache of another machine.
+func (c *Cache) Export(w io.Writer, entries []*Entry) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	for _, e := range entries {
+		err := filepath.Walk(e.dir, func(location string, f os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			relPath, err := filepath.Rel(c.dir, location)
+			if err != nil {
+				return err
+			}
+			header, err := tar.FileInfoHeader(f, "")
+			if err != nil {
+				return err
+			}
+			header.Name = filepath.ToSlash(relPath)
+			if f.IsDir() {
+				header.Name += "/"
+			}
+			if err := tw.WriteHeader(header); err != nil {
+				return err
+			}
+			if f.IsDir() {
+				return nil
+			}
+			file, err := os.Open(location)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			_, err = io.Copy(tw, file)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("exporting %s/%s: %w", e.ModID, e.Key, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// Import adds the entries of an archive written by Export. Entries already
+// cached are skipped and entries failing verification are not added. It
+// returns the imported entries.
+func (c *Cache) Import(r io.Reader) ([]*Entry, error) {
+	tmpDir, err := ioutil.TempDir(c.dir, ".import-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+	if err := extract(r, tmpDir); err != nil {
+		return nil, err
+	}
+	staged := &Cache{dir: tmpDir}
+	entries, err := staged.List()
+	if err != nil {
+		return nil, err
+	}
+	var imported []*Entry
+	for _, e := range entries {
+		if err := checkEntry(staged, e); err != nil {
+			return imported, err
+		}
+		entryDir := filepath.Join(c.dir, e.ModID, e.Key)
+		if _, err := os.Stat(entryDir); err == nil {
+			continue
+		}
+		if err := staged.Verify(e); err != nil {
+			return imported, err
+		}
+		if err := os.MkdirAll(filepath.Join(c.dir, e.ModID), 0755); err != nil {
+			return imported, err
+		}
+		if err := os.Rename(e.dir, entryDir); err != nil {
+			return imported, err
+		}
+		e.dir = entryDir
+		imported = append(imported, e)
+	}
+	return imported, nil
+}
+
+// checkEntry rejects entries of an archive whose mod id or key would place
+// them anywhere but their own directory in the cache, entry.json is part of
+// the archive and cannot be trusted.
+func checkEntry(c *Cache, e *Entry) error {
+	if e.ModID == "" || strings.Trim(e.ModID, "0123456789") != "" {
+		return fmt.Errorf("invalid mod id %q in cache archive", e.ModID)
+	}
+	if e.Key == "" || e.Key == "." || e.Key == ".." || strings.ContainsAny(e.Key, `/\`) {
+		return fmt.Errorf("invalid key %q of mod %s in cache archive", e.Key, e.ModID)
+	}
+	if e.dir != filepath.Join(c.dir, e.ModID, e.Key) {
+		return fmt.Errorf("entry %s/%s is stored in %s in cache archive", e.ModID, e.Key, e.dir)
+	}
+	return nil
+}
+
+func extract(r io.Reader, dir string) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		name := path.Clean(header.Name)
+		if path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+			return fmt.Errorf("invalid path %q in cache archive", header.Name)
+		}
+		location := filepath.Join(dir, filepath.FromSlash(name))
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(location, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(location), 0755); err != nil {
+				return err
+			}
+			file, err := os.OpenFile(location, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(file, tr)
+			file.Close()
+			if err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unsupported entry %q in cache archive", header.Name)
+		}
+	}
+}
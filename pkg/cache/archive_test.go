@@ -0,0 +1,109 @@
+package cache
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCache_ExportImport(t *testing.T) {
+	src, err := New(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := src.Add("731604991", writeRawMod(t, t.TempDir(), "v1"), "111", "", 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive := &bytes.Buffer{}
+	assert.NoError(t, src.Export(archive, []*Entry{e}))
+
+	dst, err := New(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	imported, err := dst.Import(bytes.NewReader(archive.Bytes()))
+	assert.NoError(t, err)
+	if assert.Len(t, imported, 1) {
+		assert.Equal(t, e.ContentHash, imported[0].ContentHash)
+	}
+	cached, err := dst.Lookup("731604991", "111", "")
+	if assert.NoError(t, err) {
+		got, err := ioutil.ReadFile(filepath.Join(cached.Path(), "WindowsNoEditor", "mod.info"))
+		assert.NoError(t, err)
+		assert.Equal(t, "v1", string(got))
+		assert.NoError(t, dst.Verify(cached))
+	}
+
+	imported, err = dst.Import(bytes.NewReader(archive.Bytes()))
+	assert.NoError(t, err)
+	assert.Empty(t, imported, "cached entries are skipped")
+}
+
+func TestCache_ImportRejectsEscapingPaths(t *testing.T) {
+	archive := &bytes.Buffer{}
+	gz := gzip.NewWriter(archive)
+	tw := tar.NewWriter(gz)
+	tw.WriteHeader(&tar.Header{Name: "../evil", Typeflag: tar.TypeReg, Mode: 0644, Size: 1})
+	tw.Write([]byte("x"))
+	tw.Close()
+	gz.Close()
+
+	c, err := New(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.Import(archive)
+	assert.Error(t, err)
+}
+
+func TestCache_ImportRejectsInvalidEntries(t *testing.T) {
+	tests := []struct {
+		name  string
+		modID string
+		key   string
+	}{
+		{"mod id escapes", "../../escaped", "111"},
+		{"mod id not numeric", "mods", "111"},
+		{"key escapes", "731604991", "../../escaped"},
+		{"key with separator", "731604991", "111/x"},
+		{"key parent", "731604991", ".."},
+		{"other directory", "731604992", "111"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry, err := json.Marshal(&Entry{ModID: tt.modID, Key: tt.key})
+			if err != nil {
+				t.Fatal(err)
+			}
+			archive := &bytes.Buffer{}
+			gz := gzip.NewWriter(archive)
+			tw := tar.NewWriter(gz)
+			tw.WriteHeader(&tar.Header{Name: "731604991/111/entry.json", Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(entry))})
+			tw.Write(entry)
+			tw.Close()
+			gz.Close()
+
+			root := t.TempDir()
+			c, err := New(filepath.Join(root, "cache"), 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			imported, err := c.Import(archive)
+			assert.Error(t, err)
+			assert.Empty(t, imported)
+			_, err = os.Stat(filepath.Join(root, "escaped"))
+			assert.True(t, os.IsNotExist(err), "nothing is written outside the cache")
+			entries, err := c.List()
+			assert.NoError(t, err)
+			assert.Empty(t, entries)
+		})
+	}
+}
@@ -0,0 +1,419 @@
+// Package cache stores downloaded raw mods by mod id and version, so an
+// unchanged version does not have to be downloaded again.
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/d8x/amm/pkg/fslock"
+	"github.com/otiai10/copy"
+)
+
+const (
+	entryFileName = "entry.json"
+	lockFileName  = ".lock"
+)
+
+var (
+	ErrNotCached = errors.New("mod version is not cached")
+	ErrCorrupt   = errors.New("cached content does not match its hash")
+)
+
+// Entry describes one cached version of a mod. Its content is stored in a
+// directory named like the mod id, so it can be passed to the unpacker as is.
+type Entry struct {
+	ModID       string    `json:"mod_id"`
+	Key         string    `json:"key"`
+	Manifest    string    `json:"manifest,omitempty"`
+	Platform    string    `json:"platform,omitempty"`
+	TimeUpdated int64     `json:"time_updated,omitempty"`
+	Size        int64     `json:"size"`
+	ContentHash string    `json:"content_hash"`
+	Added       time.Time `json:"added"`
+	LastUsed    time.Time `json:"last_used"`
+
+	dir string
+}
+
+// Path returns the directory with the raw mod content.
+func (e *Entry) Path() string {
+	return filepath.Join(e.dir, e.ModID)
+}
+
+// Cache keeps the raw mods in <dir>/<mod id>/<key>, the key is the workshop
+// manifest id or, when it is not known, the content hash, followed by the
+// platform the content was downloaded for.
+type Cache struct {
+	dir string
+	// keep is the number of versions kept per mod, zero keeps all.
+	keep int
+}
+
+func New(dir string, keep int) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &Cache{dir: dir, keep: keep}, nil
+}
+
+func (c *Cache) Dir() string {
+	return c.dir
+}
+
+// Lookup returns the cached version of the mod with the given manifest and platform.
+func (c *Cache) Lookup(modID, manifest, platform string) (*Entry, error) {
+	if manifest == "" {
+		return nil, ErrNotCached
+	}
+	e, err := c.readEntry(filepath.Join(c.dir, modID, entryKey(manifest, platform)))
+	if os.IsNotExist(err) {
+		return nil, ErrNotCached
+	}
+	if err != nil {
+		return nil, err
+	}
+	c.touch(e)
+	return e, nil
+}
+
+// Latest returns the most recent cached version of the mod for the platform,
+// an empty platform matches all.
+func (c *Cache) Latest(modID, platform string) (*Entry, error) {
+	entries, err := c.Versions(modID)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if platform == "" || e.Platform == platform {
+			c.touch(e)
+			return e, nil
+		}
+	}
+	return nil, ErrNotCached
+}
+
+// Versions returns the cached versions of the mod, newest first.
+func (c *Cache) Versions(modID string) ([]*Entry, error) {
+	dirs, err := ioutil.ReadDir(filepath.Join(c.dir, modID))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entries []*Entry
+	for _, d := range dirs {
+		if !d.IsDir() || strings.HasPrefix(d.Name(), ".") {
+			continue
+		}
+		e, err := c.readEntry(filepath.Join(c.dir, modID, d.Name()))
+		if err != nil {
+			fmt.Printf("skipping broken cache entry %s/%s: %v\n", modID, d.Name(), err)
+			continue
+		}
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].TimeUpdated != entries[j].TimeUpdated {
+			return entries[i].TimeUpdated > entries[j].TimeUpdated
+		}
+		return entries[i].Added.After(entries[j].Added)
+	})
+	return entries, nil
+}
+
+// List returns all cached versions of all mods.
+func (c *Cache) List() ([]*Entry, error) {
+	mods, err := ioutil.ReadDir(c.dir)
+	if err != nil {
+		return nil, err
+	}
+	var entries []*Entry
+	for _, m := range mods {
+		if !m.IsDir() || strings.HasPrefix(m.Name(), ".") {
+			continue
+		}
+		versions, err := c.Versions(m.Name())
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, versions...)
+	}
+	return entries, nil
+}
+
+// Add copies the raw mod in srcDir into the cache. When the version is
+// already cached the existing entry is returned. Older versions beyond the
+// retention limit are removed afterwards.
+func (c *Cache) Add(modID, srcDir, manifest, platform string, timeUpdated int64) (*Entry, error) {
+	lock, err := fslock.Acquire(filepath.Join(c.dir, modID, lockFileName))
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Unlock()
+	contentHash, size, err := HashDir(srcDir)
+	if err != nil {
+		return nil, err
+	}
+	key := manifest
+	if key == "" {
+		key = "sha256-" + contentHash
+	}
+	key = entryKey(key, platform)
+	entryDir := filepath.Join(c.dir, modID, key)
+	if e, err := c.readEntry(entryDir); err == nil && e.ContentHash == contentHash {
+		c.touch(e)
+		return e, nil
+	}
+	tmpDir, err := ioutil.TempDir(filepath.Join(c.dir, modID), ".add-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+	if err := copy.Copy(srcDir, filepath.Join(tmpDir, modID)); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	e := &Entry{
+		ModID:       modID,
+		Key:         key,
+		Manifest:    manifest,
+		Platform:    platform,
+		TimeUpdated: timeUpdated,
+		Size:        size,
+		ContentHash: contentHash,
+		Added:       now,
+		LastUsed:    now,
+		dir:         tmpDir,
+	}
+	if err := c.writeEntry(e); err != nil {
+		return nil, err
+	}
+	// a broken entry with the same key is replaced
+	if err := os.RemoveAll(entryDir); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmpDir, entryDir); err != nil {
+		return nil, err
+	}
+	e.dir = entryDir
+	if err := c.applyRetention(modID, platform); err != nil {
+		fmt.Printf("could not remove old versions of %s: %v\n", modID, err)
+	}
+	return e, nil
+}
+
+// applyRetention removes the old versions of the mod for the platform.
+func (c *Cache) applyRetention(modID, platform string) error {
+	if c.keep <= 0 {
+		return nil
+	}
+	versions, err := c.Versions(modID)
+	if err != nil {
+		return err
+	}
+	kept := 0
+	for _, e := range versions {
+		if e.Platform != platform {
+			continue
+		}
+		if kept++; kept > c.keep {
+			if err := c.remove(e); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func entryKey(version, platform string) string {
+	if platform == "" {
+		return version
+	}
+	return version + "-" + platform
+}
+
+// Remove deletes the cached version. It waits for downloads adding a
+// version of the same mod.
+func (c *Cache) Remove(e *Entry) error {
+	lock, err := fslock.Acquire(filepath.Join(c.dir, e.ModID, lockFileName))
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+	return c.remove(e)
+}
+
+// remove deletes the cached version, the lock of the mod has to be held.
+func (c *Cache) remove(e *Entry) error {
+	// move the entry out of sight first so it never looks half removed
+	trash := filepath.Join(c.dir, e.ModID, ".remove-"+e.Key)
+	if err := os.Rename(e.dir, trash); err != nil {
+		return err
+	}
+	return os.RemoveAll(trash)
+}
+
+// PruneOptions selects the entries removed by Prune.
+type PruneOptions struct {
+	// OlderThan removes entries not used for this long, zero disables it.
+	OlderThan time.Duration
+	// MaxSize removes the least recently used entries until the cache is at
+	// most this many bytes, zero disables it.
+	MaxSize int64
+	// Keep removes all but the newest Keep versions of every mod and platform, zero disables it.
+	Keep int
+	// DryRun only reports what would be removed.
+	DryRun bool
+}
+
+// Prune removes entries according to opts and returns the removed entries.
+func (c *Cache) Prune(opts PruneOptions) ([]*Entry, error) {
+	entries, err := c.List()
+	if err != nil {
+		return nil, err
+	}
+	remove := map[*Entry]bool{}
+	perMod := map[string]int{}
+	// List returns the versions of a mod newest first
+	for _, e := range entries {
+		key := e.ModID + "/" + e.Platform
+		perMod[key]++
+		if opts.Keep > 0 && perMod[key] > opts.Keep {
+			remove[e] = true
+		}
+		if opts.OlderThan > 0 && time.Since(e.LastUsed) > opts.OlderThan {
+			remove[e] = true
+		}
+	}
+	if opts.MaxSize > 0 {
+		sort.SliceStable(entries, func(i, j int) bool { return entries[i].LastUsed.Before(entries[j].LastUsed) })
+		var total int64
+		for _, e := range entries {
+			if !remove[e] {
+				total += e.Size
+			}
+		}
+		for _, e := range entries {
+			if total <= opts.MaxSize {
+				break
+			}
+			if !remove[e] {
+				remove[e] = true
+				total -= e.Size
+			}
+		}
+	}
+	var removed []*Entry
+	for _, e := range entries {
+		if !remove[e] {
+			continue
+		}
+		if !opts.DryRun {
+			if err := c.Remove(e); err != nil {
+				return removed, err
+			}
+		}
+		removed = append(removed, e)
+	}
+	return removed, nil
+}
+
+// Verify checks the cached content against the recorded content hash.
+func (c *Cache) Verify(e *Entry) error {
+	contentHash, _, err := HashDir(e.Path())
+	if err != nil {
+		return err
+	}
+	if contentHash != e.ContentHash {
+		return fmt.Errorf("%w: %s/%s", ErrCorrupt, e.ModID, e.Key)
+	}
+	return nil
+}
+
+func (c *Cache) readEntry(dir string) (*Entry, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, entryFileName))
+	if err != nil {
+		return nil, err
+	}
+	e := &Entry{}
+	if err := json.Unmarshal(data, e); err != nil {
+		return nil, err
+	}
+	e.dir = dir
+	return e, nil
+}
+
+func (c *Cache) writeEntry(e *Entry) error {
+	data, err := json.MarshalIndent(e, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(e.dir, entryFileName+".tmp")
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(e.dir, entryFileName))
+}
+
+// touch records the use of an entry, retention by age and size goes by it.
+func (c *Cache) touch(e *Entry) {
+	e.LastUsed = time.Now()
+	if err := c.writeEntry(e); err != nil {
+		fmt.Printf("could not update cache entry %s/%s: %v\n", e.ModID, e.Key, err)
+	}
+}
+
+// HashDir returns a sha256 over the relative paths and contents of all files
+// in dir and their total size.
+func HashDir(dir string) (string, int64, error) {
+	tree := sha256.New()
+	var size int64
+	err := filepath.Walk(dir, func(path string, f os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if f.IsDir() {
+			return nil
+		}
+		relPath, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		sum, err := hashFile(path)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(tree, "%s\x00%d\x00%s\n", filepath.ToSlash(relPath), f.Size(), sum)
+		size += f.Size()
+		return nil
+	})
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(tree.Sum(nil)), size, nil
+}
+
+func hashFile(location string) (string, error) {
+	f, err := os.Open(location)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,172 @@
+package cache
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/d8x/amm/pkg/fslock"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeRawMod(t *testing.T, dir, content string) string {
+	location := filepath.Join(dir, "WindowsNoEditor", "mod.info")
+	if err := os.MkdirAll(filepath.Dir(location), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(location, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestCache_AddLookup(t *testing.T) {
+	c, err := New(t.TempDir(), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := writeRawMod(t, t.TempDir(), "v1")
+
+	e, err := c.Add("731604991", src, "111", "", 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "731604991", filepath.Base(e.Path()))
+	assert.Equal(t, int64(2), e.Size)
+	got, err := ioutil.ReadFile(filepath.Join(e.Path(), "WindowsNoEditor", "mod.info"))
+	assert.NoError(t, err)
+	assert.Equal(t, "v1", string(got))
+
+	cached, err := c.Lookup("731604991", "111", "")
+	assert.NoError(t, err)
+	assert.Equal(t, e.ContentHash, cached.ContentHash)
+	_, err = c.Lookup("731604991", "222", "")
+	assert.Equal(t, ErrNotCached, err)
+
+	again, err := c.Add("731604991", src, "111", "", 100)
+	assert.NoError(t, err)
+	assert.Equal(t, e.Added.Unix(), again.Added.Unix(), "unchanged version is reused")
+
+	// without manifest the content hash is the key
+	writeRawMod(t, src, "v2")
+	e2, err := c.Add("731604991", src, "", "", 200)
+	assert.NoError(t, err)
+	assert.Equal(t, "sha256-"+e2.ContentHash, e2.Key)
+	_, err = c.Add("731604991", writeRawMod(t, t.TempDir(), "v3"), "333", "", 300)
+	assert.NoError(t, err)
+
+	versions, err := c.Versions("731604991")
+	assert.NoError(t, err)
+	if assert.Len(t, versions, 2, "only the newest two versions are kept") {
+		assert.Equal(t, "333", versions[0].Key)
+		assert.Equal(t, e2.Key, versions[1].Key)
+	}
+	latest, err := c.Latest("731604991", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "333", latest.Manifest)
+}
+
+func TestCache_Platforms(t *testing.T) {
+	c, err := New(t.TempDir(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	win, err := c.Add("731604991", writeRawMod(t, t.TempDir(), "win"), "111", "windows", 100)
+	assert.NoError(t, err)
+	assert.Equal(t, "111-windows", win.Key)
+	_, err = c.Add("731604991", writeRawMod(t, t.TempDir(), "linux"), "111", "linux", 100)
+	assert.NoError(t, err)
+
+	// retention applies to each platform on its own
+	versions, err := c.Versions("731604991")
+	assert.NoError(t, err)
+	assert.Len(t, versions, 2)
+
+	e, err := c.Lookup("731604991", "111", "windows")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "windows", e.Platform)
+	}
+	_, err = c.Lookup("731604991", "111", "")
+	assert.Equal(t, ErrNotCached, err)
+	latest, err := c.Latest("731604991", "linux")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "linux", latest.Platform)
+	}
+}
+
+func TestCache_Prune(t *testing.T) {
+	c, err := New(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old, err := c.Add("731604991", writeRawMod(t, t.TempDir(), "1234"), "1", "", 100)
+	assert.NoError(t, err)
+	old.LastUsed = time.Now().Add(-48 * time.Hour)
+	assert.NoError(t, c.writeEntry(old))
+	_, err = c.Add("731604991", writeRawMod(t, t.TempDir(), "12345678"), "2", "", 200)
+	assert.NoError(t, err)
+	_, err = c.Add("889745138", writeRawMod(t, t.TempDir(), "12"), "3", "", 100)
+	assert.NoError(t, err)
+
+	removed, err := c.Prune(PruneOptions{OlderThan: 24 * time.Hour, DryRun: true})
+	assert.NoError(t, err)
+	assert.Len(t, removed, 1)
+	entries, _ := c.List()
+	assert.Len(t, entries, 3)
+
+	removed, err = c.Prune(PruneOptions{MaxSize: 10})
+	assert.NoError(t, err)
+	if assert.Len(t, removed, 1) {
+		assert.Equal(t, "1", removed[0].Key, "least recently used goes first")
+	}
+	removed, err = c.Prune(PruneOptions{Keep: 1})
+	assert.NoError(t, err)
+	assert.Empty(t, removed)
+	entries, _ = c.List()
+	assert.Len(t, entries, 2)
+}
+
+func TestCache_Verify(t *testing.T) {
+	c, err := New(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := c.Add("731604991", writeRawMod(t, t.TempDir(), "v1"), "1", "", 100)
+	assert.NoError(t, err)
+	assert.NoError(t, c.Verify(e))
+	writeRawMod(t, e.Path(), "tampered")
+	assert.Error(t, c.Verify(e))
+}
+
+func TestCache_RemoveWaitsForAdd(t *testing.T) {
+	c, err := New(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := c.Add("731604991", writeRawMod(t, t.TempDir(), "v1"), "111", "", 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a download is adding another version of the mod
+	lock, err := fslock.Acquire(filepath.Join(c.Dir(), "731604991", lockFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error)
+	go func() {
+		done <- c.Remove(e)
+	}()
+	select {
+	case <-done:
+		t.Fatal("Remove deleted an entry while the mod was locked")
+	case <-time.After(100 * time.Millisecond):
+	}
+	_, err = c.Lookup("731604991", "111", "")
+	assert.NoError(t, err)
+	assert.NoError(t, lock.Unlock())
+	assert.NoError(t, <-done)
+	_, err = c.Lookup("731604991", "111", "")
+	assert.Equal(t, ErrNotCached, err)
+}
@@ -0,0 +1,263 @@
+// Package config loads amm's settings from properties files and the
+// environment. Later layers override earlier ones: the defaults, the system
+// file, the user file, an explicit file and AMM_* environment variables.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/magiconair/properties"
+)
+
+const (
+	fileName = "amm.properties"
+	// envPrefix starts the environment variables overriding settings, the
+	// key steam.dir is set with AMM_STEAM_DIR.
+	envPrefix = "AMM_"
+	// SourceDefault is the source of settings no layer sets.
+	SourceDefault = "default"
+)
+
+var ErrUnknownKey = errors.New("unknown setting")
+
+// Config holds the settings amm uses.
+type Config struct {
+	WorkDir     string `properties:"workdir"`
+	UnpackDir   string `properties:"unpack-dir"`
+	Concurrency int    `properties:"concurrency"`
+	MinFree     string `properties:"min-free"`
+	Offline     bool   `properties:"offline"`
+	// SteamDir is where amm unpacks the downloaded steamcmd.
+	SteamDir           string `properties:"steam.dir"`
+	SteamAPI           string `properties:"steam.api"`
+	GameID             string `properties:"steam.game-id"`
+	WorkshopContentDir string `properties:"steam.workshop-content-dir"`
+	SteamCMDURLWindows string `properties:"steamcmd.url.windows"`
+	SteamCMDURLLinux   string `properties:"steamcmd.url.linux"`
+	CacheKeep          int    `properties:"cache.keep"`
+	SnapshotKeep       int    `properties:"snapshot.keep"`
+	// UnpackWorkers is the number of archives unpacked in parallel, 0 uses
+	// one per cpu.
+	UnpackWorkers int `properties:"unpack.workers"`
+}
+
+// Setting describes one configuration key.
+type Setting struct {
+	Key     string
+	Default string
+	Usage   string
+}
+
+// Settings lists every key amm knows.
+var Settings = []Setting{
+	{"workdir", "amm-workdir", "Working directory"},
+	{"unpack-dir", "amm-unpacked", "Directory the mods are unpacked to"},
+	{"concurrency", "1", "Number of parallel steamcmd downloads"},
+	{"min-free", "1G", "Space downloads, unpacks and installs leave free on every filesystem"},
+	{"offline", "false", "Use only the local cache, never run steamcmd or ask the Steam Web API"},
+	{"steam.dir", "./steam", "Directory steamcmd is unpacked to by download steamcmd"},
+	{"steam.api", "https://api.steampowered.com", "Base URL of the Steam Web API"},
+	{"steam.game-id", "346110", "Steam app id of the game the workshop items are downloaded for"},
+	{"steam.workshop-content-dir", "steamapps/workshop/content", "Directory of the workshop content in the steamcmd install dir"},
+	{"steamcmd.url.windows", "https://steamcdn-a.akamaihd.net/client/installer/steamcmd.zip", "Download URL of steamcmd for windows"},
+	{"steamcmd.url.linux", "https://steamcdn-a.akamaihd.net/client/installer/steamcmd_linux.tar.gz", "Download URL of steamcmd for linux"},
+	{"cache.keep", "3", "Number of downloaded versions kept per mod"},
+	{"snapshot.keep", "5", "Number of snapshots kept per mod"},
+	{"unpack.workers", "0", "Number of archives unpacked in parallel, 0 uses one per cpu"},
+}
+
+// Lookup returns the setting of the key.
+func Lookup(key string) (Setting, error) {
+	for _, s := range Settings {
+		if s.Key == key {
+			return s, nil
+		}
+	}
+	return Setting{}, fmt.Errorf("%w: %s", ErrUnknownKey, key)
+}
+
+// EnvName returns the environment variable overriding the key.
+func EnvName(key string) string {
+	return envPrefix + strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(key))
+}
+
+// SystemFile is the configuration shared by all users of the machine.
+func SystemFile() string {
+	if runtime.GOOS == "windows" {
+		return filepath.Join(os.Getenv("ProgramData"), "amm", fileName)
+	}
+	return filepath.Join("/etc", "amm", fileName)
+}
+
+// UserFile is the configuration of the current user.
+func UserFile() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "amm", fileName), nil
+}
+
+// Default returns the built in settings.
+func Default() *Config {
+	c, err := newValues().Config()
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// Values are the merged layers of the configuration together with the
+// source of every value.
+type Values struct {
+	props   *properties.Properties
+	sources map[string]string
+}
+
+func newValues() *Values {
+	v := &Values{props: properties.NewProperties(), sources: map[string]string{}}
+	v.props.DisableExpansion = true
+	for _, s := range Settings {
+		v.props.MustSet(s.Key, s.Default)
+		v.sources[s.Key] = SourceDefault
+	}
+	return v
+}
+
+// Load merges the defaults, the system file, the user file, the explicit
+// file and the environment. The system and user files are optional, an
+// explicit file has to exist. An empty explicit path is ignored.
+func Load(explicit string, environ []string) (*Values, error) {
+	v := newValues()
+	files := []string{SystemFile()}
+	if user, err := UserFile(); err == nil {
+		files = append(files, user)
+	}
+	for _, f := range files {
+		if err := v.LoadFile(f); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	if explicit != "" {
+		if err := v.LoadFile(explicit); err != nil {
+			return nil, err
+		}
+	}
+	if err := v.LoadEnv(environ); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// LoadFile overrides the values with the settings in the properties file.
+func (v *Values) LoadFile(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	p, err := parse(data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	for _, key := range p.Keys() {
+		value, _ := p.Get(key)
+		if err := v.Set(key, value, path); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// LoadEnv overrides the values with the AMM_* variables of environ, other
+// variables are ignored.
+func (v *Values) LoadEnv(environ []string) error {
+	env := map[string]string{}
+	for _, e := range environ {
+		if i := strings.Index(e, "="); i > 0 {
+			env[e[:i]] = e[i+1:]
+		}
+	}
+	for _, s := range Settings {
+		name := EnvName(s.Key)
+		if value, ok := env[name]; ok {
+			if err := v.Set(s.Key, value, "env "+name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Set overrides the value of the key, source tells where it came from.
+func (v *Values) Set(key, value, source string) error {
+	if _, err := Lookup(key); err != nil {
+		return err
+	}
+	prev, _ := v.props.Get(key)
+	v.props.MustSet(key, value)
+	if _, err := v.Config(); err != nil {
+		v.props.MustSet(key, prev)
+		return fmt.Errorf("invalid value %q for %s: %w", value, key, err)
+	}
+	v.sources[key] = source
+	return nil
+}
+
+// Get returns the value of the key and where it came from.
+func (v *Values) Get(key string) (value, source string, err error) {
+	if _, err := Lookup(key); err != nil {
+		return "", "", err
+	}
+	value, _ = v.props.Get(key)
+	return value, v.sources[key], nil
+}
+
+// Config decodes the values.
+func (v *Values) Config() (*Config, error) {
+	c := &Config{}
+	if err := v.props.Decode(c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// WriteFile sets the key in the properties file, other settings and comments
+// in the file are kept. The file is created when it does not exist.
+func WriteFile(path, key, value string) error {
+	if err := newValues().Set(key, value, path); err != nil {
+		return err
+	}
+	p := properties.NewProperties()
+	p.DisableExpansion = true
+	data, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil {
+		if p, err = parse(data); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	p.MustSet(key, value)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	var b strings.Builder
+	if _, err := p.WriteComment(&b, "# ", properties.UTF8); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, []byte(b.String()), 0644)
+}
+
+// parse reads a properties file. Values are taken literally, amm does not
+// expand ${key} references.
+func parse(data []byte) (*properties.Properties, error) {
+	l := &properties.Loader{Encoding: properties.UTF8, DisableExpansion: true}
+	return l.LoadBytes(data)
+}
@@ -0,0 +1,129 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDefault(t *testing.T) {
+	c := Default()
+	assert.Equal(t, "amm-workdir", c.WorkDir)
+	assert.Equal(t, "./steam", c.SteamDir)
+	assert.Equal(t, "346110", c.GameID)
+	assert.Equal(t, "steamapps/workshop/content", c.WorkshopContentDir)
+	assert.Equal(t, 3, c.CacheKeep)
+	assert.Equal(t, 5, c.SnapshotKeep)
+	assert.Equal(t, 1, c.Concurrency)
+}
+
+func TestEnvName(t *testing.T) {
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"workdir", "AMM_WORKDIR"},
+		{"unpack-dir", "AMM_UNPACK_DIR"},
+		{"steam.game-id", "AMM_STEAM_GAME_ID"},
+		{"steamcmd.url.linux", "AMM_STEAMCMD_URL_LINUX"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			assert.Equal(t, tt.want, EnvName(tt.key))
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	home := t.TempDir()
+	prev, ok := os.LookupEnv("XDG_CONFIG_HOME")
+	os.Setenv("XDG_CONFIG_HOME", home)
+	defer func() {
+		if ok {
+			os.Setenv("XDG_CONFIG_HOME", prev)
+		} else {
+			os.Unsetenv("XDG_CONFIG_HOME")
+		}
+	}()
+	user, err := UserFile()
+	assert.NoError(t, err)
+	writeFile(t, user, "workdir = /srv/user\ncache.keep = 5\nsteam.dir = /srv/steam\n")
+	explicit := filepath.Join(t.TempDir(), "amm.properties")
+	writeFile(t, explicit, "# explicit file\nworkdir = /srv/explicit\ncache.keep = 7\n")
+
+	values, err := Load(explicit, []string{"AMM_CACHE_KEEP=9", "AMM_UNKNOWN=1", "PATH=/bin"})
+	assert.NoError(t, err)
+	c, err := values.Config()
+	assert.NoError(t, err)
+	assert.Equal(t, "/srv/explicit", c.WorkDir)
+	assert.Equal(t, 9, c.CacheKeep)
+	assert.Equal(t, "/srv/steam", c.SteamDir)
+	assert.Equal(t, "amm-unpacked", c.UnpackDir)
+
+	tests := []struct {
+		key    string
+		source string
+	}{
+		{"workdir", explicit},
+		{"cache.keep", "env AMM_CACHE_KEEP"},
+		{"steam.dir", user},
+		{"unpack-dir", SourceDefault},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			_, source, err := values.Get(tt.key)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.source, source)
+		})
+	}
+
+	_, err = Load(filepath.Join(t.TempDir(), "missing.properties"), nil)
+	assert.True(t, os.IsNotExist(err))
+	writeFile(t, explicit, "workers = 2\n")
+	_, err = Load(explicit, nil)
+	assert.Error(t, err)
+	_, err = Load("", []string{"AMM_CONCURRENCY=many"})
+	assert.Error(t, err)
+}
+
+func TestSet(t *testing.T) {
+	values := newValues()
+	assert.NoError(t, values.Set("concurrency", "4", "flag --concurrency"))
+	assert.Error(t, values.Set("concurrency", "four", "flag --concurrency"))
+	assert.Error(t, values.Set("nope", "1", "flag --nope"))
+	value, source, err := values.Get("concurrency")
+	assert.NoError(t, err)
+	assert.Equal(t, "4", value)
+	assert.Equal(t, "flag --concurrency", source)
+	c, err := values.Config()
+	assert.NoError(t, err)
+	assert.Equal(t, 4, c.Concurrency)
+}
+
+func TestWriteFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "amm", "amm.properties")
+	assert.NoError(t, WriteFile(path, "workdir", "/srv/amm"))
+	assert.NoError(t, WriteFile(path, "cache.keep", "2"))
+	assert.NoError(t, WriteFile(path, "workdir", "/srv/other"))
+	assert.Error(t, WriteFile(path, "cache.keep", "two"))
+	assert.Error(t, WriteFile(path, "nope", "1"))
+
+	values := newValues()
+	assert.NoError(t, values.LoadFile(path))
+	c, err := values.Config()
+	assert.NoError(t, err)
+	assert.Equal(t, "/srv/other", c.WorkDir)
+	assert.Equal(t, 2, c.CacheKeep)
+}
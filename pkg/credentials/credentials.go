@@ -0,0 +1,70 @@
+// Package credentials looks up the password of a Steam account from the
+// environment, a password file or an encrypted store.
+package credentials
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+const (
+	UsernameEnv = "AMM_STEAM_USERNAME"
+	PasswordEnv = "AMM_STEAM_PASSWORD"
+)
+
+var (
+	ErrNoPassword          = errors.New("no password found for steam account")
+	ErrInsecurePermissions = errors.New("file is accessible by other users")
+)
+
+// Sources tells Password where to look, in the order of the fields.
+type Sources struct {
+	// Env reads PasswordEnv.
+	Env bool
+	// File is a file holding only the password, it must not be accessible by other users.
+	File string
+	// Store is the encrypted store, nil skips it.
+	Store *Store
+}
+
+// Password returns the password of username from the first source which has one.
+func (s Sources) Password(username string) (string, error) {
+	if s.Env {
+		if password := os.Getenv(PasswordEnv); password != "" {
+			return password, nil
+		}
+	}
+	if s.File != "" {
+		return ReadPasswordFile(s.File)
+	}
+	if s.Store != nil {
+		password, err := s.Store.Get(username)
+		if err == nil || !errors.Is(err, ErrNoPassword) {
+			return password, err
+		}
+	}
+	return "", fmt.Errorf("%w %s", ErrNoPassword, username)
+}
+
+// ReadPasswordFile reads the first line of the file as password.
+func ReadPasswordFile(location string) (string, error) {
+	stat, err := os.Stat(location)
+	if err != nil {
+		return "", err
+	}
+	if err := checkPermissions(stat); err != nil {
+		return "", fmt.Errorf("%s: %w", location, err)
+	}
+	data, err := ioutil.ReadFile(location)
+	if err != nil {
+		return "", err
+	}
+	password := strings.TrimRight(strings.SplitN(string(data), "\n", 2)[0], "\r")
+	if password == "" {
+		return "", fmt.Errorf("%s: password file is empty", location)
+	}
+	return password, nil
+}
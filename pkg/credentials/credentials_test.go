@@ -0,0 +1,94 @@
+package credentials
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSources_Password(t *testing.T) {
+	dir := t.TempDir()
+	passwordFile := filepath.Join(dir, "password")
+	if err := ioutil.WriteFile(passwordFile, []byte("from-file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	store := NewStore(filepath.Join(dir, "store"))
+	if err := store.Set("survivor", "from-store"); err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv(PasswordEnv, "from-env")
+	defer os.Unsetenv(PasswordEnv)
+
+	tests := []struct {
+		name    string
+		sources Sources
+		want    string
+		wantErr error
+	}{
+		{name: "env", sources: Sources{Env: true, File: passwordFile, Store: store}, want: "from-env"},
+		{name: "file", sources: Sources{File: passwordFile, Store: store}, want: "from-file"},
+		{name: "store", sources: Sources{Store: store}, want: "from-store"},
+		{name: "none", sources: Sources{}, wantErr: ErrNoPassword},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.sources.Password("survivor")
+			if tt.wantErr != nil {
+				assert.True(t, errors.Is(err, tt.wantErr), "got %v", err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestReadPasswordFile(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes are not checked on windows")
+	}
+	location := filepath.Join(t.TempDir(), "password")
+	if err := ioutil.WriteFile(location, []byte("secret\r\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := ReadPasswordFile(location)
+	assert.True(t, errors.Is(err, ErrInsecurePermissions), "got %v", err)
+
+	assert.NoError(t, os.Chmod(location, 0600))
+	password, err := ReadPasswordFile(location)
+	assert.NoError(t, err)
+	assert.Equal(t, "secret", password)
+}
+
+func TestStore(t *testing.T) {
+	dir := t.TempDir()
+	store := NewStore(dir)
+	_, err := store.Get("survivor")
+	assert.True(t, errors.Is(err, ErrNoPassword))
+
+	assert.NoError(t, store.Set("survivor", "hunter2"))
+	assert.NoError(t, store.Set("admin", "correct horse"))
+	password, err := NewStore(dir).Get("survivor")
+	assert.NoError(t, err)
+	assert.Equal(t, "hunter2", password)
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, storeFileName))
+	assert.NoError(t, err)
+	assert.NotContains(t, string(data), "hunter2")
+
+	assert.NoError(t, store.Set("survivor", ""))
+	_, err = store.Get("survivor")
+	assert.True(t, errors.Is(err, ErrNoPassword))
+
+	// a store encrypted with another key is refused
+	if err := ioutil.WriteFile(filepath.Join(dir, keyFileName), make([]byte, keySize), 0600); err != nil {
+		t.Fatal(err)
+	}
+	_, err = store.Get("admin")
+	assert.Equal(t, ErrCorruptStore, err)
+}
@@ -0,0 +1,14 @@
+//go:build !windows
+// +build !windows
+
+package credentials
+
+import "os"
+
+// checkPermissions refuses files which group or others can access.
+func checkPermissions(stat os.FileInfo) error {
+	if stat.Mode().Perm()&0077 != 0 {
+		return ErrInsecurePermissions
+	}
+	return nil
+}
@@ -0,0 +1,12 @@
+//go:build windows
+// +build windows
+
+package credentials
+
+import "os"
+
+// checkPermissions accepts all files, access on windows is controlled by
+// ACLs which the file mode does not show.
+func checkPermissions(stat os.FileInfo) error {
+	return nil
+}
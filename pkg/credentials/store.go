@@ -0,0 +1,161 @@
+package credentials
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+const (
+	keyFileName   = "credentials.key"
+	storeFileName = "credentials.enc"
+	keySize       = 32
+)
+
+var ErrCorruptStore = errors.New("credential store cannot be decrypted")
+
+// Store keeps passwords encrypted with AES-GCM in dir. The key is kept in its
+// own file next to the store, readable only by the owner, so copying the
+// store alone does not reveal the passwords.
+type Store struct {
+	dir string
+}
+
+// DefaultStoreDir is the amm directory in the user config dir.
+func DefaultStoreDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "amm"), nil
+}
+
+func NewStore(dir string) *Store {
+	return &Store{dir: dir}
+}
+
+// Get returns the stored password of username.
+func (s *Store) Get(username string) (string, error) {
+	passwords, err := s.read()
+	if err != nil {
+		return "", err
+	}
+	password, ok := passwords[username]
+	if !ok {
+		return "", fmt.Errorf("%w %s in %s", ErrNoPassword, username, s.dir)
+	}
+	return password, nil
+}
+
+// Set stores the password of username, an empty password removes it.
+func (s *Store) Set(username, password string) error {
+	passwords, err := s.read()
+	if err != nil {
+		return err
+	}
+	if password == "" {
+		delete(passwords, username)
+	} else {
+		passwords[username] = password
+	}
+	return s.write(passwords)
+}
+
+func (s *Store) read() (map[string]string, error) {
+	passwords := map[string]string{}
+	data, err := ioutil.ReadFile(filepath.Join(s.dir, storeFileName))
+	if os.IsNotExist(err) {
+		return passwords, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	key, err := s.key(false)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, ErrCorruptStore
+	}
+	plain, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, ErrCorruptStore
+	}
+	if err := json.Unmarshal(plain, &passwords); err != nil {
+		return nil, ErrCorruptStore
+	}
+	return passwords, nil
+}
+
+func (s *Store) write(passwords map[string]string) error {
+	plain, err := json.Marshal(passwords)
+	if err != nil {
+		return err
+	}
+	key, err := s.key(true)
+	if err != nil {
+		return err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return err
+	}
+	tmp := filepath.Join(s.dir, storeFileName+".tmp")
+	if err := ioutil.WriteFile(tmp, gcm.Seal(nonce, nonce, plain, nil), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(s.dir, storeFileName))
+}
+
+// key reads the store key, it is generated when create is set and there is none.
+func (s *Store) key(create bool) ([]byte, error) {
+	location := filepath.Join(s.dir, keyFileName)
+	stat, err := os.Stat(location)
+	if os.IsNotExist(err) && create {
+		if err := os.MkdirAll(s.dir, 0700); err != nil {
+			return nil, err
+		}
+		key := make([]byte, keySize)
+		if _, err := io.ReadFull(rand.Reader, key); err != nil {
+			return nil, err
+		}
+		return key, ioutil.WriteFile(location, key, 0600)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := checkPermissions(stat); err != nil {
+		return nil, fmt.Errorf("%s: %w", location, err)
+	}
+	key, err := ioutil.ReadFile(location)
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != keySize {
+		return nil, fmt.Errorf("%s: invalid key size %d", location, len(key))
+	}
+	return key, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,246 @@
+// Package deps resolves the required workshop items of mods into a
+// dependency graph and orders mods so dependencies come first.
+package deps
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Lookup returns the required items of each of the given mods.
+type Lookup interface {
+	RequiredItems(ctx context.Context, modIDs []string) (map[string][]string, error)
+}
+
+// CycleError is returned when mods require each other.
+type CycleError struct {
+	Cycle []string
+}
+
+func (e *CycleError) Error() string {
+	return "dependency cycle: " + strings.Join(e.Cycle, " -> ")
+}
+
+// Graph holds the requested mods and everything they require.
+type Graph struct {
+	Roots []string
+	// Requires maps a mod to the mods it requires, in workshop order.
+	Requires map[string][]string
+}
+
+// Resolve looks up the required items of roots and of all their
+// dependencies, level by level.
+func Resolve(ctx context.Context, lookup Lookup, roots []string) (*Graph, error) {
+	g := &Graph{Roots: roots, Requires: map[string][]string{}}
+	seen := map[string]bool{}
+	pending := []string{}
+	for _, id := range roots {
+		if !seen[id] {
+			seen[id] = true
+			pending = append(pending, id)
+		}
+	}
+	for len(pending) > 0 {
+		required, err := lookup.RequiredItems(ctx, pending)
+		if err != nil {
+			return nil, err
+		}
+		var next []string
+		for _, id := range pending {
+			g.Requires[id] = required[id]
+			for _, dep := range required[id] {
+				if !seen[dep] {
+					seen[dep] = true
+					next = append(next, dep)
+				}
+			}
+		}
+		pending = next
+	}
+	return g, nil
+}
+
+// Mods returns all mods of the graph, dependencies before their dependents.
+func (g *Graph) Mods() ([]string, error) {
+	var order []string
+	visited := map[string]bool{}
+	for _, id := range g.Roots {
+		if err := g.visit(id, visited, map[string]bool{}, nil, &order); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+func (g *Graph) visit(id string, visited, active map[string]bool, path []string, order *[]string) error {
+	path = append(path, id)
+	if active[id] {
+		start := 0
+		for path[start] != id {
+			start++
+		}
+		return &CycleError{Cycle: append([]string{}, path[start:]...)}
+	}
+	if visited[id] {
+		return nil
+	}
+	active[id] = true
+	for _, dep := range g.Requires[id] {
+		if err := g.visit(dep, visited, active, path, order); err != nil {
+			return err
+		}
+	}
+	active[id] = false
+	visited[id] = true
+	*order = append(*order, id)
+	return nil
+}
+
+// Sort reorders mods so every mod comes after the mods it requires, mods
+// without a constraint between them keep their relative order. Mods unknown
+// to the graph are kept in place relative to the others.
+func (g *Graph) Sort(mods []string) ([]string, error) {
+	index := map[string]int{}
+	for i, id := range mods {
+		if _, ok := index[id]; !ok {
+			index[id] = i
+		}
+	}
+	// waiting counts the dependencies of a mod in the list which are not placed yet
+	waiting := map[string]int{}
+	dependents := map[string][]string{}
+	for id := range index {
+		for _, dep := range g.Requires[id] {
+			if _, ok := index[dep]; ok && dep != id {
+				waiting[id]++
+				dependents[dep] = append(dependents[dep], id)
+			}
+		}
+	}
+	var ready []string
+	for id := range index {
+		if waiting[id] == 0 {
+			ready = append(ready, id)
+		}
+	}
+	var sorted []string
+	for len(ready) > 0 {
+		sort.Slice(ready, func(i, j int) bool { return index[ready[i]] < index[ready[j]] })
+		id := ready[0]
+		ready = ready[1:]
+		sorted = append(sorted, id)
+		for _, dependent := range dependents[id] {
+			waiting[dependent]--
+			if waiting[dependent] == 0 {
+				ready = append(ready, dependent)
+			}
+		}
+	}
+	if len(sorted) != len(index) {
+		// the remaining mods require each other, let Mods name the cycle
+		var rest []string
+		for _, id := range mods {
+			if waiting[id] > 0 {
+				rest = append(rest, id)
+			}
+		}
+		if _, err := (&Graph{Roots: rest, Requires: g.Requires}).Mods(); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("could not order mods %v", rest)
+	}
+	return sorted, nil
+}
+
+// Dependents returns the mods of the graph which directly require id, in
+// ascending order.
+func (g *Graph) Dependents(id string) []string {
+	var dependents []string
+	for mod, required := range g.Requires {
+		if mod == id {
+			continue
+		}
+		for _, dep := range required {
+			if dep == id {
+				dependents = append(dependents, mod)
+				break
+			}
+		}
+	}
+	sort.Strings(dependents)
+	return dependents
+}
+
+// WriteTree prints the graph as an indented tree. Mods already printed
+// further up are marked instead of being expanded again.
+func (g *Graph) WriteTree(w io.Writer, titles map[string]string) error {
+	printed := map[string]bool{}
+	for _, id := range g.Roots {
+		if err := g.writeTree(w, id, titles, 0, printed, map[string]bool{}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g *Graph) writeTree(w io.Writer, id string, titles map[string]string, depth int, printed, active map[string]bool) error {
+	label := id
+	if title := titles[id]; title != "" {
+		label = fmt.Sprintf("%s %s", id, title)
+	}
+	indent := strings.Repeat("  ", depth)
+	switch {
+	case active[id]:
+		_, err := fmt.Fprintf(w, "%s%s (cycle)\n", indent, label)
+		return err
+	case printed[id] && len(g.Requires[id]) > 0:
+		_, err := fmt.Fprintf(w, "%s%s (see above)\n", indent, label)
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "%s%s\n", indent, label); err != nil {
+		return err
+	}
+	printed[id] = true
+	active[id] = true
+	defer delete(active, id)
+	for _, dep := range g.Requires[id] {
+		if err := g.writeTree(w, dep, titles, depth+1, printed, active); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteDOT exports the graph in graphviz format, edges point from a mod to
+// the mods it requires.
+func (g *Graph) WriteDOT(w io.Writer, titles map[string]string) error {
+	var ids []string
+	for id := range g.Requires {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	if _, err := fmt.Fprintln(w, "digraph mods {"); err != nil {
+		return err
+	}
+	for _, id := range ids {
+		label := id
+		if title := titles[id]; title != "" {
+			label = fmt.Sprintf("%s\n%s", title, id)
+		}
+		if _, err := fmt.Fprintf(w, "\t%q [label=%q];\n", id, label); err != nil {
+			return err
+		}
+	}
+	for _, id := range ids {
+		for _, dep := range g.Requires[id] {
+			if _, err := fmt.Fprintf(w, "\t%q -> %q;\n", id, dep); err != nil {
+				return err
+			}
+		}
+	}
+	_, err := fmt.Fprintln(w, "}")
+	return err
+}
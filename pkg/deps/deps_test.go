@@ -0,0 +1,82 @@
+package deps
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeLookup map[string][]string
+
+func (f fakeLookup) RequiredItems(ctx context.Context, modIDs []string) (map[string][]string, error) {
+	required := map[string][]string{}
+	for _, id := range modIDs {
+		if deps, ok := f[id]; ok {
+			required[id] = deps
+		}
+	}
+	return required, nil
+}
+
+func TestResolve(t *testing.T) {
+	lookup := fakeLookup{
+		"1": {"2", "3"},
+		"2": {"4"},
+		"3": {"4"},
+		"5": {"4"},
+	}
+	g, err := Resolve(context.Background(), lookup, []string{"1", "5"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mods, err := g.Mods()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"4", "2", "3", "1", "5"}, mods)
+
+	sorted, err := g.Sort([]string{"5", "1", "9", "3", "4", "2"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"9", "4", "5", "3", "2", "1"}, sorted)
+
+	tree := bytes.Buffer{}
+	assert.NoError(t, g.WriteTree(&tree, map[string]string{"1": "Framework"}))
+	assert.Equal(t, "1 Framework\n  2\n    4\n  3\n    4\n5\n  4\n", tree.String())
+
+	dot := bytes.Buffer{}
+	assert.NoError(t, g.WriteDOT(&dot, map[string]string{"1": "Framework"}))
+	assert.Contains(t, dot.String(), "\"1\" [label=\"Framework\\n1\"];\n")
+	assert.Contains(t, dot.String(), "\"2\" -> \"4\";\n")
+}
+
+func TestCycle(t *testing.T) {
+	lookup := fakeLookup{
+		"1": {"2"},
+		"2": {"3"},
+		"3": {"2"},
+	}
+	g, err := Resolve(context.Background(), lookup, []string{"1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = g.Mods()
+	assert.Equal(t, &CycleError{Cycle: []string{"2", "3", "2"}}, err)
+	_, err = g.Sort([]string{"3", "2", "1"})
+	assert.IsType(t, &CycleError{}, err)
+
+	tree := bytes.Buffer{}
+	assert.NoError(t, g.WriteTree(&tree, nil))
+	assert.Equal(t, "1\n  2\n    3\n      2 (cycle)\n", tree.String())
+}
+
+func TestGraph_Dependents(t *testing.T) {
+	g := &Graph{Requires: map[string][]string{
+		"1": {"2", "3"},
+		"2": {"4"},
+		"3": {"4"},
+		"4": {"4"},
+	}}
+	assert.Equal(t, []string{"2", "3"}, g.Dependents("4"))
+	assert.Equal(t, []string{"1"}, g.Dependents("2"))
+	assert.Empty(t, g.Dependents("1"))
+}
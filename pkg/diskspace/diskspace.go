@@ -0,0 +1,117 @@
+// Package diskspace checks that the filesystems amm writes to have enough
+// free space before it starts writing.
+package diskspace
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Need is the space a write into Path is expected to take.
+type Need struct {
+	Path  string
+	Bytes int64
+}
+
+// InsufficientSpaceError reports a filesystem which would have less than the
+// margin left after the writes.
+type InsufficientSpaceError struct {
+	// Path is the first path on the filesystem.
+	Path   string
+	Needed int64
+	Free   int64
+	Margin int64
+}
+
+func (e *InsufficientSpaceError) Error() string {
+	return fmt.Sprintf("not enough free space for %s: %s needed and %s have to stay free, but only %s are free",
+		e.Path, formatSize(e.Needed), formatSize(e.Margin), formatSize(e.Free))
+}
+
+func formatSize(size int64) string {
+	units := []string{"B", "K", "M", "G", "T"}
+	value := float64(size)
+	unit := 0
+	for value >= 1024 && unit < len(units)-1 {
+		value /= 1024
+		unit++
+	}
+	if unit == 0 {
+		return fmt.Sprintf("%dB", size)
+	}
+	return fmt.Sprintf("%.1f%s", value, units[unit])
+}
+
+// Check adds up the needs per filesystem and returns an
+// *InsufficientSpaceError for the first filesystem on which less than margin
+// bytes would be left. Paths which do not exist yet are checked on the
+// filesystem of their closest existing parent.
+func Check(needs []Need, margin int64) error {
+	type filesystem struct {
+		path   string
+		needed int64
+	}
+	var order []string
+	filesystems := map[string]*filesystem{}
+	for _, n := range needs {
+		path, err := existingParent(n.Path)
+		if err != nil {
+			return err
+		}
+		id, err := filesystemID(path)
+		if err != nil {
+			return err
+		}
+		fs, ok := filesystems[id]
+		if !ok {
+			fs = &filesystem{path: n.Path}
+			filesystems[id] = fs
+			order = append(order, id)
+		}
+		fs.needed += n.Bytes
+	}
+	for _, id := range order {
+		fs := filesystems[id]
+		path, err := existingParent(fs.path)
+		if err != nil {
+			return err
+		}
+		free, err := Free(path)
+		if err != nil {
+			return err
+		}
+		if fs.needed+margin > free {
+			return &InsufficientSpaceError{Path: fs.path, Needed: fs.needed, Free: free, Margin: margin}
+		}
+	}
+	return nil
+}
+
+// Free returns the bytes available to amm on the filesystem of path.
+func Free(path string) (int64, error) {
+	path, err := existingParent(path)
+	if err != nil {
+		return 0, err
+	}
+	return freeBytes(path)
+}
+
+func existingParent(path string) (string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	for {
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		} else if !os.IsNotExist(err) {
+			return "", err
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return path, nil
+		}
+		path = parent
+	}
+}
@@ -0,0 +1,27 @@
+package diskspace
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheck(t *testing.T) {
+	dir := t.TempDir()
+	free, err := Free(filepath.Join(dir, "not", "there", "yet"))
+	assert.NoError(t, err)
+	assert.True(t, free > 0)
+
+	assert.NoError(t, Check([]Need{{Path: dir, Bytes: 1}}, 0))
+	assert.NoError(t, Check(nil, 0))
+
+	err = Check([]Need{{Path: dir, Bytes: free / 2}, {Path: filepath.Join(dir, "unpacked"), Bytes: free / 2}}, free)
+	var spaceErr *InsufficientSpaceError
+	if assert.True(t, errors.As(err, &spaceErr)) {
+		assert.Equal(t, dir, spaceErr.Path)
+		assert.Equal(t, free/2*2, spaceErr.Needed, "needs on one filesystem add up")
+		assert.Equal(t, free, spaceErr.Margin)
+	}
+}
@@ -0,0 +1,26 @@
+//go:build !windows
+// +build !windows
+
+package diskspace
+
+import (
+	"strconv"
+	"syscall"
+)
+
+func freeBytes(path string) (int64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, err
+	}
+	// Bavail counts the blocks available to unprivileged users
+	return int64(uint64(st.Bavail) * uint64(st.Bsize)), nil
+}
+
+func filesystemID(path string) (string, error) {
+	var st syscall.Stat_t
+	if err := syscall.Stat(path, &st); err != nil {
+		return "", err
+	}
+	return strconv.FormatUint(uint64(st.Dev), 10), nil
+}
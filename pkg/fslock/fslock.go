@@ -0,0 +1,59 @@
+// Package fslock provides advisory file locks used to keep concurrent amm
+// processes on one host from working on the same files.
+package fslock
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+var ErrLocked = errors.New("lock is held by another process")
+
+type Lock struct {
+	path string
+	file *os.File
+}
+
+// Acquire blocks until the lock file at path is exclusively locked.
+func Acquire(path string) (*Lock, error) {
+	return acquire(path, true)
+}
+
+// TryAcquire returns ErrLocked instead of blocking when the lock is already held.
+func TryAcquire(path string) (*Lock, error) {
+	return acquire(path, false)
+}
+
+func acquire(path string, wait bool) (*Lock, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockFile(f, wait); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &Lock{path: path, file: f}, nil
+}
+
+func (l *Lock) Path() string {
+	return l.path
+}
+
+// Unlock releases the lock. The lock file itself is kept so other processes
+// waiting on it keep locking the same inode.
+func (l *Lock) Unlock() error {
+	if l == nil || l.file == nil {
+		return nil
+	}
+	err := unlockFile(l.file)
+	if cerr := l.file.Close(); err == nil {
+		err = cerr
+	}
+	l.file = nil
+	return err
+}
@@ -0,0 +1,24 @@
+package fslock
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTryAcquire(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "locks", "mod.lock")
+	first, err := TryAcquire(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = TryAcquire(path)
+	assert.Equal(t, ErrLocked, err)
+
+	assert.NoError(t, first.Unlock())
+	second, err := TryAcquire(path)
+	assert.NoError(t, err)
+	assert.NoError(t, second.Unlock())
+	assert.NoError(t, second.Unlock())
+}
@@ -0,0 +1,336 @@
+// Package journal moves staged mods into place with renames and records the
+// move on disk first, so a move interrupted by a crash is completed by the
+// next run instead of leaving a mod half old and half new. Moves into one
+// root are serialized with a lock file next to it.
+package journal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/d8x/amm/pkg/fslock"
+)
+
+const (
+	dirName    = ".amm-journal"
+	oldSuffix  = ".old"
+	modFileExt = ".mod"
+	lockSuffix = ".lock"
+	// filesName is the journal of moves which only replace files.
+	filesName = "files"
+)
+
+var ErrNotStaged = errors.New("staging dir has no mod folder")
+
+// File is a staged file which replaces Dst. Staged has to be on the same
+// filesystem as Dst.
+type File struct {
+	Staged string `json:"staged"`
+	Dst    string `json:"dst"`
+}
+
+// Stage writes the files a move puts into place. It runs while the lock of
+// the root is held, so files derived from their current content, like a
+// changed setting, do not overwrite a concurrent change.
+type Stage func() ([]File, error)
+
+// entry is the journal of one move. It is written once everything is staged
+// and removed once the move is done.
+type entry struct {
+	ModID      string `json:"mod_id,omitempty"`
+	StagingDir string `json:"staging_dir,omitempty"`
+	// Remove deletes the mod instead of replacing it.
+	Remove bool `json:"remove,omitempty"`
+	// NoModFile deletes the .mod file of the replaced version, the new one
+	// comes without.
+	NoModFile bool `json:"no_mod_file,omitempty"`
+	// Files are moved into place after the mod.
+	Files   []File    `json:"files,omitempty"`
+	Started time.Time `json:"started"`
+}
+
+func (e *entry) name() string {
+	if e.ModID == "" {
+		return filesName
+	}
+	return e.ModID
+}
+
+func journalPath(root, name string) string {
+	return filepath.Join(root, dirName, name+".json")
+}
+
+// Lock blocks until no other process moves mods into root. The lock file is
+// kept next to root, so the server never sees it.
+func Lock(root string) (*fslock.Lock, error) {
+	return fslock.Acquire(filepath.Clean(root) + lockSuffix)
+}
+
+// Swap moves <stagingDir>/<modID> and <stagingDir>/<modID>.mod into root,
+// replacing the previous version, and then the files. Without a staged .mod
+// file the one of the previous version is removed. stagingDir has to be on
+// the same filesystem as root and is removed afterwards.
+func Swap(root, modID, stagingDir string, files ...File) error {
+	if err := checkModID(modID); err != nil {
+		return err
+	}
+	if stat, err := os.Stat(filepath.Join(stagingDir, modID)); err != nil || !stat.IsDir() {
+		return ErrNotStaged
+	}
+	_, err := os.Stat(filepath.Join(stagingDir, modID+modFileExt))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return run(root, &entry{ModID: modID, StagingDir: stagingDir, NoModFile: err != nil, Files: files}, nil)
+}
+
+// Remove deletes the content folder and .mod file of the mod from root and
+// moves the files stage writes into place in the same journaled step. stage
+// may be nil.
+func Remove(root, modID string, stage Stage) error {
+	if err := checkModID(modID); err != nil {
+		return err
+	}
+	return run(root, &entry{ModID: modID, Remove: true}, stage)
+}
+
+// Replace moves the files stage writes over their destinations, root is the
+// mods folder whose journal records the move.
+func Replace(root string, stage Stage) error {
+	return run(root, &entry{}, stage)
+}
+
+func checkModID(modID string) error {
+	if modID == "" || modID == "." || modID == ".." || strings.ContainsAny(modID, `/\`) {
+		return fmt.Errorf("invalid mod id %q", modID)
+	}
+	return nil
+}
+
+// run stages, journals and completes the move while holding the lock of
+// root. Moves a crashed run left behind are completed first.
+func run(root string, e *entry, stage Stage) error {
+	lock, err := Lock(root)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+	if _, err := recoverEntries(root); err != nil {
+		return err
+	}
+	if stage != nil {
+		files, err := stage()
+		e.Files = append(e.Files, files...)
+		if err != nil {
+			removeStaged(files)
+			return err
+		}
+	}
+	if e.ModID == "" && len(e.Files) == 0 {
+		return nil
+	}
+	e.Started = time.Now().UTC()
+	if err := writeEntry(root, e); err != nil {
+		removeStaged(e.Files)
+		return err
+	}
+	return complete(root, e)
+}
+
+// removeStaged deletes staged files which are not journaled.
+func removeStaged(files []File) {
+	for _, f := range files {
+		os.Remove(f.Staged)
+	}
+}
+
+// Recover completes the moves into root which were interrupted and returns
+// the ids of their mods. A move is rolled forward while its staged mod
+// folder is there, otherwise the previous version is put back.
+func Recover(root string) ([]string, error) {
+	if _, err := os.Stat(filepath.Join(root, dirName)); os.IsNotExist(err) {
+		return nil, nil
+	}
+	lock, err := Lock(root)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Unlock()
+	return recoverEntries(root)
+}
+
+// Pending returns the ids of the mods whose moves into root were interrupted
+// without completing them, an empty id stands for a move of files only. It
+// neither takes the lock nor changes anything, a running move is pending too.
+func Pending(root string) ([]string, error) {
+	entries, err := ioutil.ReadDir(filepath.Join(root, dirName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var pending []string
+	for _, f := range entries {
+		name := strings.TrimSuffix(f.Name(), ".json")
+		if f.IsDir() || name == f.Name() {
+			continue
+		}
+		if name == filesName {
+			name = ""
+		}
+		pending = append(pending, name)
+	}
+	return pending, nil
+}
+
+// recoverEntries completes the journaled moves, the lock of root has to be held.
+func recoverEntries(root string) ([]string, error) {
+	entries, err := ioutil.ReadDir(filepath.Join(root, dirName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var recovered []string
+	for _, f := range entries {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), ".json") {
+			continue
+		}
+		location := filepath.Join(root, dirName, f.Name())
+		data, err := ioutil.ReadFile(location)
+		if err != nil {
+			return recovered, err
+		}
+		e := &entry{}
+		if err := json.Unmarshal(data, e); err != nil || (e.ModID == "" && len(e.Files) == 0) {
+			// written incompletely, so nothing was moved yet
+			if err := os.Remove(location); err != nil {
+				return recovered, err
+			}
+			continue
+		}
+		if err := complete(root, e); err != nil {
+			return recovered, fmt.Errorf("journal %s: %w", e.name(), err)
+		}
+		if e.ModID != "" {
+			recovered = append(recovered, e.ModID)
+		}
+	}
+	return recovered, nil
+}
+
+// complete runs the steps of the move which are not done yet. Every step
+// is a rename or removal which is skipped when its result is already there.
+func complete(root string, e *entry) error {
+	if e.ModID != "" {
+		if err := completeMod(root, e); err != nil {
+			return err
+		}
+	}
+	for _, f := range e.Files {
+		if _, err := os.Stat(f.Staged); err == nil {
+			if err := os.Rename(f.Staged, f.Dst); err != nil {
+				return err
+			}
+		}
+	}
+	if err := os.Remove(journalPath(root, e.name())); err != nil {
+		return err
+	}
+	// fails while other moves are journaled
+	os.Remove(filepath.Join(root, dirName))
+	return nil
+}
+
+func completeMod(root string, e *entry) error {
+	dst := filepath.Join(root, e.ModID)
+	old := dst + oldSuffix
+	if e.Remove {
+		if _, err := os.Stat(dst); err == nil {
+			if err := os.RemoveAll(old); err != nil {
+				return err
+			}
+			if err := os.Rename(dst, old); err != nil {
+				return err
+			}
+		}
+		if err := os.Remove(dst + modFileExt); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return os.RemoveAll(old)
+	}
+	staged := filepath.Join(e.StagingDir, e.ModID)
+	if _, err := os.Stat(staged); err == nil {
+		if _, err := os.Stat(dst); err == nil {
+			if err := os.RemoveAll(old); err != nil {
+				return err
+			}
+			if err := os.Rename(dst, old); err != nil {
+				return err
+			}
+		}
+		if err := os.Rename(staged, dst); err != nil {
+			return err
+		}
+	} else if _, err := os.Stat(dst); os.IsNotExist(err) {
+		// the staged folder is lost, roll back to the previous version
+		if _, err := os.Stat(old); err == nil {
+			if err := os.Rename(old, dst); err != nil {
+				return err
+			}
+		}
+		return os.RemoveAll(e.StagingDir)
+	}
+	stagedModFile := filepath.Join(e.StagingDir, e.ModID+modFileExt)
+	if _, err := os.Stat(stagedModFile); err == nil {
+		if err := os.Rename(stagedModFile, filepath.Join(root, e.ModID+modFileExt)); err != nil {
+			return err
+		}
+	} else if e.NoModFile {
+		if err := os.Remove(filepath.Join(root, e.ModID+modFileExt)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := os.RemoveAll(old); err != nil {
+		return err
+	}
+	return os.RemoveAll(e.StagingDir)
+}
+
+// writeEntry writes the journal durably, the move must not start before it
+// is on disk.
+func writeEntry(root string, e *entry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	location := journalPath(root, e.name())
+	if err := os.MkdirAll(filepath.Dir(location), 0755); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(location), ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), location)
+}
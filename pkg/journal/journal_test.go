@@ -0,0 +1,197 @@
+package journal
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// stage writes a mod folder with one file of the given content and a .mod file into dir.
+func stage(t *testing.T, dir, modID, content string) {
+	if err := os.MkdirAll(filepath.Join(dir, modID), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, modID, "mod.info"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, modID+".mod"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readFile(t *testing.T, location string) string {
+	data, err := ioutil.ReadFile(location)
+	assert.NoError(t, err)
+	return string(data)
+}
+
+func TestSwap(t *testing.T) {
+	root := t.TempDir()
+	stage(t, root, "731604991", "old")
+	stagingDir := filepath.Join(root, ".staging-731604991")
+	stage(t, stagingDir, "731604991", "new")
+
+	assert.NoError(t, Swap(root, "731604991", stagingDir))
+	assert.Equal(t, "new", readFile(t, filepath.Join(root, "731604991", "mod.info")))
+	assert.Equal(t, "new", readFile(t, filepath.Join(root, "731604991.mod")))
+	entries, err := ioutil.ReadDir(root)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2, "staging dir, old version and journal are removed")
+
+	assert.Equal(t, ErrNotStaged, Swap(root, "731604991", stagingDir))
+}
+
+func TestSwapWithoutModFile(t *testing.T) {
+	root := t.TempDir()
+	stage(t, root, "731604991", "old")
+	stagingDir := filepath.Join(root, ".staging-731604991")
+	stage(t, stagingDir, "731604991", "new")
+	assert.NoError(t, os.Remove(filepath.Join(stagingDir, "731604991.mod")))
+
+	assert.NoError(t, Swap(root, "731604991", stagingDir))
+	assert.Equal(t, "new", readFile(t, filepath.Join(root, "731604991", "mod.info")))
+	_, err := os.Stat(filepath.Join(root, "731604991.mod"))
+	assert.True(t, os.IsNotExist(err), "the .mod file of the old version is removed")
+}
+
+func TestRecover(t *testing.T) {
+	tests := []struct {
+		name string
+		// crash leaves the state after an interrupted move
+		crash    func(t *testing.T, root, stagingDir string)
+		expected string
+	}{
+		{"before the move", func(t *testing.T, root, stagingDir string) {}, "new"},
+		{"old version moved aside", func(t *testing.T, root, stagingDir string) {
+			assert.NoError(t, os.Rename(filepath.Join(root, "731604991"), filepath.Join(root, "731604991.old")))
+		}, "new"},
+		{"mod folder moved", func(t *testing.T, root, stagingDir string) {
+			assert.NoError(t, os.Rename(filepath.Join(root, "731604991"), filepath.Join(root, "731604991.old")))
+			assert.NoError(t, os.Rename(filepath.Join(stagingDir, "731604991"), filepath.Join(root, "731604991")))
+		}, "new"},
+		{"staged folder lost", func(t *testing.T, root, stagingDir string) {
+			assert.NoError(t, os.Rename(filepath.Join(root, "731604991"), filepath.Join(root, "731604991.old")))
+			assert.NoError(t, os.RemoveAll(stagingDir))
+		}, "old"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			stage(t, root, "731604991", "old")
+			stagingDir := filepath.Join(root, ".staging-731604991")
+			stage(t, stagingDir, "731604991", "new")
+			e := &entry{ModID: "731604991", StagingDir: stagingDir}
+			if err := writeEntry(root, e); err != nil {
+				t.Fatal(err)
+			}
+			tt.crash(t, root, stagingDir)
+
+			recovered, err := Recover(root)
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"731604991"}, recovered)
+			assert.Equal(t, tt.expected, readFile(t, filepath.Join(root, "731604991", "mod.info")))
+			for _, leftover := range []string{stagingDir, filepath.Join(root, "731604991.old"), filepath.Join(root, dirName)} {
+				_, err := os.Stat(leftover)
+				assert.True(t, os.IsNotExist(err), leftover)
+			}
+			recovered, err = Recover(root)
+			assert.NoError(t, err)
+			assert.Empty(t, recovered)
+		})
+	}
+}
+
+func TestRemove(t *testing.T) {
+	tests := []struct {
+		name  string
+		crash bool
+	}{
+		{"completed", false},
+		{"recovered after a crash", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			stage(t, root, "731604991", "old")
+			settings := filepath.Join(t.TempDir(), "GameUserSettings.ini")
+			staged := settings + ".staged"
+			if err := ioutil.WriteFile(staged, []byte("ActiveMods="), 0644); err != nil {
+				t.Fatal(err)
+			}
+			files := []File{{Staged: staged, Dst: settings}}
+			if tt.crash {
+				// the content folder was moved aside before the crash
+				if err := writeEntry(root, &entry{ModID: "731604991", Remove: true, Files: files}); err != nil {
+					t.Fatal(err)
+				}
+				assert.NoError(t, os.Rename(filepath.Join(root, "731604991"), filepath.Join(root, "731604991.old")))
+				recovered, err := Recover(root)
+				assert.NoError(t, err)
+				assert.Equal(t, []string{"731604991"}, recovered)
+			} else {
+				assert.NoError(t, Remove(root, "731604991", func() ([]File, error) { return files, nil }))
+			}
+			entries, err := ioutil.ReadDir(root)
+			assert.NoError(t, err)
+			assert.Empty(t, entries)
+			assert.Equal(t, "ActiveMods=", readFile(t, settings))
+		})
+	}
+	assert.Error(t, Remove(t.TempDir(), "..", nil))
+}
+
+func TestRecoverWaitsForLock(t *testing.T) {
+	root := t.TempDir()
+	stage(t, root, "731604991", "old")
+	stagingDir := filepath.Join(root, ".staging-731604991")
+	stage(t, stagingDir, "731604991", "new")
+	// another process is in the middle of the swap
+	lock, err := Lock(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writeEntry(root, &entry{ModID: "731604991", StagingDir: stagingDir}); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan []string)
+	go func() {
+		recovered, err := Recover(root)
+		assert.NoError(t, err)
+		done <- recovered
+	}()
+	select {
+	case <-done:
+		t.Fatal("Recover completed a swap while it was locked")
+	case <-time.After(100 * time.Millisecond):
+	}
+	assert.Equal(t, "old", readFile(t, filepath.Join(root, "731604991", "mod.info")))
+	assert.NoError(t, complete(root, &entry{ModID: "731604991", StagingDir: stagingDir}))
+	assert.NoError(t, lock.Unlock())
+	assert.Empty(t, <-done)
+	assert.Equal(t, "new", readFile(t, filepath.Join(root, "731604991", "mod.info")))
+}
+
+func TestPending(t *testing.T) {
+	root := t.TempDir()
+	pending, err := Pending(root)
+	assert.NoError(t, err)
+	assert.Empty(t, pending)
+
+	stage(t, root, "731604991", "old")
+	stagingDir := filepath.Join(root, ".staging-731604991")
+	stage(t, stagingDir, "731604991", "new")
+	if err := writeEntry(root, &entry{ModID: "731604991", StagingDir: stagingDir}); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeEntry(root, &entry{Files: []File{{Staged: "a", Dst: "b"}}}); err != nil {
+		t.Fatal(err)
+	}
+	pending, err = Pending(root)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"731604991", ""}, pending)
+	assert.Equal(t, "old", readFile(t, filepath.Join(root, "731604991", "mod.info")), "nothing is recovered")
+}
@@ -0,0 +1,147 @@
+package server
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/d8x/amm/pkg/journal"
+)
+
+// Reasons a Mods folder entry is an orphan.
+const (
+	OrphanUnused    = "not in ActiveMods"
+	OrphanNoContent = ".mod file without content folder"
+	OrphanNoModFile = "content folder without .mod file"
+	OrphanLeftover  = "leftover of an interrupted install"
+)
+
+// builtinMods are shipped with the server in the Mods folder and never
+// orphans. The official DLC maps are shipped there too, their folders are
+// not named like a workshop id, so InstalledMods never returns them.
+var builtinMods = map[string]bool{
+	"111111111": true, // Primitive+
+}
+
+// IsBuiltinMod reports whether the mod comes with the server itself.
+func IsBuiltinMod(id string) bool {
+	return builtinMods[id]
+}
+
+// Orphan is an entry of the Mods folder the server does not need.
+type Orphan struct {
+	ID     string
+	Reason string
+	Paths  []string
+	Size   int64
+}
+
+// Orphans returns the mods in the Mods folder which are incomplete, or which
+// are neither in ActiveMods nor in keep, and the staging folders left behind
+// by interrupted installs. Built-in mods and folders not named like a
+// workshop id, such as the official DLC maps, are never orphans.
+func (s *Server) Orphans(keep map[string]bool) ([]Orphan, error) {
+	installed, err := s.InstalledMods()
+	if err != nil {
+		return nil, err
+	}
+	active, err := s.ActiveMods()
+	if err != nil {
+		return nil, err
+	}
+	used := map[string]bool{}
+	for _, id := range active {
+		used[id] = true
+	}
+	var orphans []Orphan
+	for _, m := range installed {
+		if IsBuiltinMod(m.ID) {
+			continue
+		}
+		o := Orphan{ID: m.ID}
+		switch {
+		case m.ContentDir == "":
+			o.Reason = OrphanNoContent
+		case m.ModFile == "":
+			o.Reason = OrphanNoModFile
+		case !used[m.ID] && !keep[m.ID]:
+			o.Reason = OrphanUnused
+		default:
+			continue
+		}
+		for _, location := range []string{m.ContentDir, m.ModFile} {
+			if location != "" {
+				o.Paths = append(o.Paths, location)
+			}
+		}
+		orphans = append(orphans, o)
+	}
+	leftovers, err := s.leftovers()
+	if err != nil {
+		return nil, err
+	}
+	orphans = append(orphans, leftovers...)
+	for i := range orphans {
+		for _, location := range orphans[i].Paths {
+			size, err := DirSize(location)
+			if err != nil {
+				return nil, err
+			}
+			orphans[i].Size += size
+		}
+	}
+	return orphans, nil
+}
+
+// leftovers returns the staging folders and moved aside old versions which
+// an install removes once it is done.
+func (s *Server) leftovers() ([]Orphan, error) {
+	entries, err := ioutil.ReadDir(s.ModsDir())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var orphans []Orphan
+	for _, e := range entries {
+		name := e.Name()
+		id := ""
+		switch {
+		case strings.HasPrefix(name, ".staging-"):
+			id = strings.SplitN(strings.TrimPrefix(name, ".staging-"), "-", 2)[0]
+		case strings.HasSuffix(name, ".old"):
+			id = strings.TrimSuffix(name, ".old")
+		}
+		if !isModID(id) || !e.IsDir() {
+			continue
+		}
+		orphans = append(orphans, Orphan{
+			ID:     id,
+			Reason: OrphanLeftover,
+			Paths:  []string{filepath.Join(s.ModsDir(), name)},
+		})
+	}
+	return orphans, nil
+}
+
+// RemoveOrphan deletes the files of the orphan. Mods are removed through the
+// journal of the Mods folder, leftovers while holding its lock, so a running
+// install does not lose its old version.
+func (s *Server) RemoveOrphan(o Orphan) error {
+	if o.Reason != OrphanLeftover {
+		return journal.Remove(s.ModsDir(), o.ID, nil)
+	}
+	lock, err := journal.Lock(s.ModsDir())
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+	for _, location := range o.Paths {
+		if err := os.RemoveAll(location); err != nil {
+			return err
+		}
+	}
+	return nil
+}
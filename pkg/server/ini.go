@@ -0,0 +1,144 @@
+package server
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// iniFile is a minimal line based editor for the unreal engine ini files.
+// Everything it does not touch, including comments, duplicate keys and the
+// line endings, is written back unchanged.
+type iniFile struct {
+	lines []string
+	crlf  bool
+}
+
+func readINI(location string) (*iniFile, error) {
+	data, err := ioutil.ReadFile(location)
+	if os.IsNotExist(err) {
+		return &iniFile{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	text := strings.TrimPrefix(string(data), "\uFEFF")
+	f := &iniFile{crlf: strings.Contains(text, "\r\n")}
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.TrimSuffix(text, "\n")
+	if text != "" {
+		f.lines = strings.Split(text, "\n")
+	}
+	return f, nil
+}
+
+// section returns the line range of the keys of section, end is exclusive.
+func (f *iniFile) section(name string) (start, end int, ok bool) {
+	start = -1
+	for i, line := range f.lines {
+		trimmed := strings.TrimSpace(line)
+		if !strings.HasPrefix(trimmed, "[") || !strings.HasSuffix(trimmed, "]") {
+			continue
+		}
+		if start >= 0 {
+			return start, i, true
+		}
+		if strings.EqualFold(trimmed[1:len(trimmed)-1], name) {
+			start = i + 1
+		}
+	}
+	if start >= 0 {
+		return start, len(f.lines), true
+	}
+	return 0, 0, false
+}
+
+func (f *iniFile) keyLine(section, key string) int {
+	start, end, ok := f.section(section)
+	if !ok {
+		return -1
+	}
+	for i := start; i < end; i++ {
+		k, _, ok := splitKeyValue(f.lines[i])
+		if ok && strings.EqualFold(k, key) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (f *iniFile) get(section, key string) (string, bool) {
+	i := f.keyLine(section, key)
+	if i < 0 {
+		return "", false
+	}
+	_, v, _ := splitKeyValue(f.lines[i])
+	return v, true
+}
+
+func (f *iniFile) set(section, key, value string) {
+	line := key + "=" + value
+	if i := f.keyLine(section, key); i >= 0 {
+		f.lines[i] = line
+		return
+	}
+	start, end, ok := f.section(section)
+	if !ok {
+		if len(f.lines) > 0 && strings.TrimSpace(f.lines[len(f.lines)-1]) != "" {
+			f.lines = append(f.lines, "")
+		}
+		f.lines = append(f.lines, "["+section+"]", line)
+		return
+	}
+	// keep blank lines separating the sections after the new key
+	insert := end
+	for insert > start && strings.TrimSpace(f.lines[insert-1]) == "" {
+		insert--
+	}
+	f.lines = append(f.lines[:insert], append([]string{line}, f.lines[insert:]...)...)
+}
+
+// stage writes the file next to location and returns the staged copy,
+// which replaces location once it is renamed over it.
+func (f *iniFile) stage(location string) (string, error) {
+	newline := "\n"
+	if f.crlf {
+		newline = "\r\n"
+	}
+	data := strings.Join(f.lines, newline) + newline
+	if err := os.MkdirAll(filepath.Dir(location), 0755); err != nil {
+		return "", err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(location), ".amm-ini-")
+	if err != nil {
+		return "", err
+	}
+	if _, err := tmp.WriteString(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return tmp.Name(), nil
+}
+
+func splitKeyValue(line string) (string, string, bool) {
+	trimmed := strings.TrimSpace(line)
+	if trimmed == "" || strings.HasPrefix(trimmed, ";") || strings.HasPrefix(trimmed, "[") {
+		return "", "", false
+	}
+	i := strings.Index(trimmed, "=")
+	if i < 0 {
+		return "", "", false
+	}
+	return strings.TrimSpace(trimmed[:i]), strings.TrimSpace(trimmed[i+1:]), true
+}
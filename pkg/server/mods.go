@@ -0,0 +1,142 @@
+package server
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/d8x/amm/pkg/journal"
+)
+
+const modFileExt = ".mod"
+
+// InstalledMod is a mod found in the Mods folder, by its content folder, its
+// .mod file or both.
+type InstalledMod struct {
+	ID string
+	// ContentDir is empty when the mod has no content folder.
+	ContentDir string
+	// ModFile is empty when the mod has no .mod file.
+	ModFile string
+	// ModTime is when the .mod file, or without one the content folder, was written.
+	ModTime time.Time
+}
+
+// Complete reports whether the mod has both its content and .mod file.
+func (m InstalledMod) Complete() bool {
+	return m.ContentDir != "" && m.ModFile != ""
+}
+
+// InstalledMods returns the mods in the Mods folder ordered by id. Only
+// entries named like a workshop id are considered.
+func (s *Server) InstalledMods() ([]InstalledMod, error) {
+	entries, err := ioutil.ReadDir(s.ModsDir())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	mods := map[string]*InstalledMod{}
+	get := func(id string) *InstalledMod {
+		if m, ok := mods[id]; ok {
+			return m
+		}
+		m := &InstalledMod{ID: id}
+		mods[id] = m
+		return m
+	}
+	for _, e := range entries {
+		name := e.Name()
+		switch {
+		case e.IsDir() && isModID(name):
+			m := get(name)
+			m.ContentDir = filepath.Join(s.ModsDir(), name)
+			if m.ModTime.IsZero() {
+				m.ModTime = e.ModTime()
+			}
+		case !e.IsDir() && strings.HasSuffix(name, modFileExt) && isModID(strings.TrimSuffix(name, modFileExt)):
+			m := get(strings.TrimSuffix(name, modFileExt))
+			m.ModFile = filepath.Join(s.ModsDir(), name)
+			m.ModTime = e.ModTime()
+		}
+	}
+	var installed []InstalledMod
+	for _, m := range mods {
+		installed = append(installed, *m)
+	}
+	sort.Slice(installed, func(i, j int) bool {
+		a, _ := strconv.ParseUint(installed[i].ID, 10, 64)
+		b, _ := strconv.ParseUint(installed[j].ID, 10, 64)
+		return a < b
+	})
+	return installed, nil
+}
+
+// ModPaths returns the content folder and .mod file of the mod which exist
+// in the Mods folder.
+func (s *Server) ModPaths(id string) []string {
+	var paths []string
+	for _, location := range []string{filepath.Join(s.ModsDir(), id), filepath.Join(s.ModsDir(), id+modFileExt)} {
+		if _, err := os.Lstat(location); err == nil {
+			paths = append(paths, location)
+		}
+	}
+	return paths
+}
+
+// RemoveMod deletes the content folder and .mod file of the mod and drops it
+// from ActiveMods in one journaled step of the Mods folder.
+func (s *Server) RemoveMod(id string) error {
+	if !isModID(id) {
+		return fmt.Errorf("invalid mod id %q", id)
+	}
+	return journal.Remove(s.ModsDir(), id, func() ([]journal.File, error) {
+		active, err := s.ActiveMods()
+		if err != nil {
+			return nil, err
+		}
+		var kept []string
+		for _, activeID := range active {
+			if activeID != id {
+				kept = append(kept, activeID)
+			}
+		}
+		if len(kept) == len(active) {
+			return nil, nil
+		}
+		staged, err := s.stageActiveMods(kept)
+		if err != nil {
+			return nil, err
+		}
+		return []journal.File{staged}, nil
+	})
+}
+
+// DirSize returns the total size of the files in dir.
+func DirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.Walk(dir, func(path string, f os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !f.IsDir() {
+			size += f.Size()
+		}
+		return nil
+	})
+	return size, err
+}
+
+func isModID(name string) bool {
+	if name == "" {
+		return false
+	}
+	_, err := strconv.ParseUint(name, 10, 64)
+	return err == nil
+}
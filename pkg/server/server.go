@@ -0,0 +1,171 @@
+// Package server works with the files of an ARK dedicated server install:
+// the Mods folder and the ActiveMods setting in GameUserSettings.ini.
+package server
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/d8x/amm/pkg/journal"
+)
+
+const (
+	modsDir                = "ShooterGame/Content/Mods"
+	configDir              = "ShooterGame/Saved/Config"
+	gameUserSettingsFile   = "GameUserSettings.ini"
+	serverSettingsSection  = "ServerSettings"
+	activeModsKey          = "ActiveMods"
+	windowsServerConfigDir = "WindowsServer"
+	linuxServerConfigDir   = "LinuxServer"
+	binariesDir            = "ShooterGame/Binaries"
+)
+
+var ErrNotAServer = errors.New("not an ARK server directory, ShooterGame is missing")
+
+type Server struct {
+	dir string
+}
+
+// New opens the ARK server installed in dir.
+func New(dir string) (*Server, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	stat, err := os.Stat(filepath.Join(dir, "ShooterGame"))
+	if err != nil || !stat.IsDir() {
+		return nil, ErrNotAServer
+	}
+	return &Server{dir: dir}, nil
+}
+
+// FromModsDir opens the server whose Mods folder is location. It returns
+// ErrNotAServer for other folders, such as unpack directories.
+func FromModsDir(location string) (*Server, error) {
+	location, err := filepath.Abs(location)
+	if err != nil {
+		return nil, err
+	}
+	dir := location
+	for range strings.Split(modsDir, "/") {
+		dir = filepath.Dir(dir)
+	}
+	s, err := New(dir)
+	if err != nil {
+		return nil, err
+	}
+	if s.ModsDir() != location {
+		return nil, ErrNotAServer
+	}
+	return s, nil
+}
+
+func (s *Server) Dir() string {
+	return s.dir
+}
+
+// ModsDir is where the server loads the unpacked mods and their .mod files from.
+func (s *Server) ModsDir() string {
+	return filepath.Join(s.dir, modsDir)
+}
+
+// GameUserSettingsPath returns the GameUserSettings.ini of the server. An
+// existing LinuxServer or WindowsServer config is preferred, otherwise the
+// one of the current platform is used.
+func (s *Server) GameUserSettingsPath() string {
+	dirs := []string{windowsServerConfigDir, linuxServerConfigDir}
+	if runtime.GOOS != "windows" {
+		dirs = []string{linuxServerConfigDir, windowsServerConfigDir}
+	}
+	for _, d := range dirs {
+		location := filepath.Join(s.dir, configDir, d, gameUserSettingsFile)
+		if _, err := os.Stat(location); err == nil {
+			return location
+		}
+	}
+	return filepath.Join(s.dir, configDir, dirs[0], gameUserSettingsFile)
+}
+
+// Platform returns "windows" or "linux", the platform the server binaries
+// are built for. Without binaries the saved config decides, then the host.
+func (s *Server) Platform() string {
+	for _, p := range []struct{ dir, platform string }{
+		{filepath.Join(binariesDir, "Win64"), "windows"},
+		{filepath.Join(binariesDir, "Linux"), "linux"},
+		{filepath.Join(configDir, windowsServerConfigDir), "windows"},
+		{filepath.Join(configDir, linuxServerConfigDir), "linux"},
+	} {
+		if stat, err := os.Stat(filepath.Join(s.dir, p.dir)); err == nil && stat.IsDir() {
+			return p.platform
+		}
+	}
+	if runtime.GOOS == "windows" {
+		return "windows"
+	}
+	return "linux"
+}
+
+// ActiveMods returns the mod ids in the order the server loads them.
+func (s *Server) ActiveMods() ([]string, error) {
+	f, err := readINI(s.GameUserSettingsPath())
+	if err != nil {
+		return nil, err
+	}
+	value, _ := f.get(serverSettingsSection, activeModsKey)
+	var mods []string
+	for _, id := range strings.Split(value, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			mods = append(mods, id)
+		}
+	}
+	return mods, nil
+}
+
+// SetActiveMods replaces the ActiveMods setting, keeping the rest of the
+// file. The new file is moved into place through the journal of the Mods
+// folder.
+func (s *Server) SetActiveMods(mods []string) error {
+	return s.UpdateActiveMods(func([]string) ([]string, error) {
+		return mods, nil
+	})
+}
+
+// UpdateActiveMods replaces the ActiveMods setting with what update returns
+// for the current one. The setting is read and replaced while holding the
+// lock of the Mods folder, so concurrent changes are not lost.
+func (s *Server) UpdateActiveMods(update func(active []string) ([]string, error)) error {
+	return journal.Replace(s.ModsDir(), func() ([]journal.File, error) {
+		active, err := s.ActiveMods()
+		if err != nil {
+			return nil, err
+		}
+		mods, err := update(active)
+		if err != nil {
+			return nil, err
+		}
+		staged, err := s.stageActiveMods(mods)
+		if err != nil {
+			return nil, err
+		}
+		return []journal.File{staged}, nil
+	})
+}
+
+// stageActiveMods writes the settings with the new ActiveMods next to the
+// GameUserSettings.ini.
+func (s *Server) stageActiveMods(mods []string) (journal.File, error) {
+	location := s.GameUserSettingsPath()
+	f, err := readINI(location)
+	if err != nil {
+		return journal.File{}, err
+	}
+	f.set(serverSettingsSection, activeModsKey, strings.Join(mods, ","))
+	staged, err := f.stage(location)
+	if err != nil {
+		return journal.File{}, err
+	}
+	return journal.File{Staged: staged, Dst: location}, nil
+}
@@ -0,0 +1,218 @@
+package server
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestServer creates an empty server layout with the given GameUserSettings.ini.
+func newTestServer(t *testing.T, gameUserSettings string) *Server {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, modsDir), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if gameUserSettings != "" {
+		location := filepath.Join(dir, configDir, linuxServerConfigDir, gameUserSettingsFile)
+		if err := os.MkdirAll(filepath.Dir(location), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(location, []byte(gameUserSettings), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s, err := New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestServer_ActiveMods(t *testing.T) {
+	s := newTestServer(t, "[ServerSettings]\r\nServerPassword=\r\nActiveMods=731604991, 889745138\r\n\r\n[SessionSettings]\r\nSessionName=amm\r\n")
+	mods, err := s.ActiveMods()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"731604991", "889745138"}, mods)
+
+	assert.NoError(t, s.SetActiveMods([]string{"889745138", "731604991", "751991809"}))
+	data, err := ioutil.ReadFile(s.GameUserSettingsPath())
+	assert.NoError(t, err)
+	assert.Equal(t, "[ServerSettings]\r\nServerPassword=\r\nActiveMods=889745138,731604991,751991809\r\n\r\n[SessionSettings]\r\nSessionName=amm\r\n", string(data))
+}
+
+func TestServer_SetActiveModsMissingKey(t *testing.T) {
+	s := newTestServer(t, "[ServerSettings]\nServerPassword=\n\n[SessionSettings]\nSessionName=amm\n")
+	assert.NoError(t, s.SetActiveMods([]string{"731604991"}))
+	data, err := ioutil.ReadFile(s.GameUserSettingsPath())
+	assert.NoError(t, err)
+	assert.Equal(t, "[ServerSettings]\nServerPassword=\nActiveMods=731604991\n\n[SessionSettings]\nSessionName=amm\n", string(data))
+
+	empty := newTestServer(t, "")
+	mods, err := empty.ActiveMods()
+	assert.NoError(t, err)
+	assert.Empty(t, mods)
+	assert.NoError(t, empty.SetActiveMods([]string{"731604991"}))
+	data, err = ioutil.ReadFile(empty.GameUserSettingsPath())
+	assert.NoError(t, err)
+	assert.Equal(t, "[ServerSettings]\nActiveMods=731604991\n", string(data))
+}
+
+func TestServer_ActiveModsConcurrentChanges(t *testing.T) {
+	s := newTestServer(t, "[ServerSettings]\nActiveMods=1,2,3,4\n")
+	var wg sync.WaitGroup
+	for i := 1; i <= 4; i++ {
+		wg.Add(2)
+		go func(id string) {
+			defer wg.Done()
+			assert.NoError(t, s.RemoveMod(id))
+		}(strconv.Itoa(i))
+		go func(id string) {
+			defer wg.Done()
+			assert.NoError(t, s.UpdateActiveMods(func(active []string) ([]string, error) {
+				return append(active, id), nil
+			}))
+		}(strconv.Itoa(i + 10))
+	}
+	wg.Wait()
+	mods, err := s.ActiveMods()
+	assert.NoError(t, err)
+	sort.Strings(mods)
+	assert.Equal(t, []string{"11", "12", "13", "14"}, mods, "no change is lost")
+}
+
+func TestNew(t *testing.T) {
+	_, err := New(t.TempDir())
+	assert.Equal(t, ErrNotAServer, err)
+}
+
+func TestFromModsDir(t *testing.T) {
+	s := newTestServer(t, "")
+	opened, err := FromModsDir(s.ModsDir())
+	assert.NoError(t, err)
+	assert.Equal(t, s.Dir(), opened.Dir())
+
+	for _, location := range []string{t.TempDir(), filepath.Join(s.Dir(), "ShooterGame", "Content")} {
+		_, err := FromModsDir(location)
+		assert.Equal(t, ErrNotAServer, err, location)
+	}
+}
+
+func TestServer_Platform(t *testing.T) {
+	s := newTestServer(t, "[ServerSettings]\n")
+	assert.Equal(t, "linux", s.Platform(), "LinuxServer config")
+
+	if err := os.MkdirAll(filepath.Join(s.Dir(), binariesDir, "Win64"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "windows", s.Platform(), "binaries win over the config")
+}
+
+func TestServer_InstalledMods(t *testing.T) {
+	s := newTestServer(t, "")
+	for _, dir := range []string{"731604991", "889745138", "Ragnarok"} {
+		if err := os.MkdirAll(filepath.Join(s.ModsDir(), dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, f := range []string{"731604991.mod", "1999.mod", "Ragnarok.mod"} {
+		if err := ioutil.WriteFile(filepath.Join(s.ModsDir(), f), []byte("mod"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(s.ModsDir(), "731604991", "mod.info"), []byte("info"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	mods, err := s.InstalledMods()
+	assert.NoError(t, err)
+	var ids []string
+	for _, m := range mods {
+		ids = append(ids, m.ID)
+	}
+	assert.Equal(t, []string{"1999", "731604991", "889745138"}, ids)
+	assert.True(t, mods[1].Complete())
+	assert.Empty(t, mods[0].ContentDir)
+	assert.Empty(t, mods[2].ModFile)
+
+	size, err := DirSize(mods[1].ContentDir)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), size)
+}
+
+func TestServer_RemoveMod(t *testing.T) {
+	s := newTestServer(t, "[ServerSettings]\nActiveMods=731604991,889745138\n")
+	if err := os.MkdirAll(filepath.Join(s.ModsDir(), "731604991", "Maps"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(s.ModsDir(), "731604991.mod"), []byte("mod"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{filepath.Join(s.ModsDir(), "731604991"), filepath.Join(s.ModsDir(), "731604991.mod")}, s.ModPaths("731604991"))
+
+	assert.NoError(t, s.RemoveMod("731604991"))
+	assert.Empty(t, s.ModPaths("731604991"))
+	mods, err := s.ActiveMods()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"889745138"}, mods)
+	entries, err := ioutil.ReadDir(s.ModsDir())
+	assert.NoError(t, err)
+	assert.Empty(t, entries, "journal and old version are removed")
+	entries, err = ioutil.ReadDir(filepath.Dir(s.GameUserSettingsPath()))
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1, "staged settings are moved into place")
+
+	assert.NoError(t, s.RemoveMod("751991809"), "removing a missing mod is not an error")
+	assert.Error(t, s.RemoveMod("../Maps"))
+}
+
+func TestServer_Orphans(t *testing.T) {
+	s := newTestServer(t, "[ServerSettings]\nActiveMods=731604991\n")
+	for _, dir := range []string{"731604991", "889745138", "751991809", "812655342", "111111111", "TheCenter", ".staging-731604991-42", "889745138.old"} {
+		if err := os.MkdirAll(filepath.Join(s.ModsDir(), dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, f := range []string{"731604991.mod", "889745138.mod", "751991809.mod", "1999.mod", "111111111.mod", "889745138/mod.info"} {
+		if err := ioutil.WriteFile(filepath.Join(s.ModsDir(), f), []byte("mod"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	orphans, err := s.Orphans(map[string]bool{"751991809": true})
+	assert.NoError(t, err)
+	reasons := map[string]string{}
+	for _, o := range orphans {
+		reasons[o.ID+" "+o.Reason] = filepath.Base(o.Paths[0])
+	}
+	assert.Equal(t, map[string]string{
+		"1999 " + OrphanNoContent:      "1999.mod",
+		"812655342 " + OrphanNoModFile: "812655342",
+		"889745138 " + OrphanUnused:    "889745138",
+		"731604991 " + OrphanLeftover:  ".staging-731604991-42",
+		"889745138 " + OrphanLeftover:  "889745138.old",
+	}, reasons)
+	for _, o := range orphans {
+		if o.ID == "889745138" && o.Reason == OrphanUnused {
+			assert.Equal(t, int64(6), o.Size)
+			assert.NoError(t, s.RemoveOrphan(o))
+		}
+	}
+	assert.Empty(t, s.ModPaths("889745138"))
+}
+
+func TestServer_OrphansKeepsShippedContent(t *testing.T) {
+	s := newTestServer(t, "[ServerSettings]\nActiveMods=731604991\n")
+	// the DLC maps and Primitive+ come without a .mod file and are not in ActiveMods
+	for _, dir := range []string{"TheCenter", "Ragnarok", "Valguero", "CrystalIsles", "LostIsland", "Fjordur", "111111111"} {
+		if err := os.MkdirAll(filepath.Join(s.ModsDir(), dir, "Maps"), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	orphans, err := s.Orphans(nil)
+	assert.NoError(t, err)
+	assert.Empty(t, orphans)
+}
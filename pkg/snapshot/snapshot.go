@@ -0,0 +1,306 @@
+// Package snapshot keeps copies of installed mod versions, so an update
+// which breaks a server can be rolled back.
+package snapshot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/d8x/amm/pkg/fslock"
+	"github.com/d8x/amm/pkg/journal"
+)
+
+const (
+	infoFileName  = "snapshot.json"
+	contentDir    = "content"
+	modFileName   = "mod"
+	lockFileName  = ".lock"
+	modFileExt    = ".mod"
+	idTimeFormat  = "20060102T150405Z"
+	stagingPrefix = ".staging-"
+)
+
+var (
+	ErrNotInstalled = errors.New("mod is not installed")
+	ErrNoSnapshot   = errors.New("no snapshot found")
+)
+
+// Snapshot is a copy of the content folder and .mod file of a mod as it was
+// installed in Target.
+type Snapshot struct {
+	ID    string `json:"id"`
+	ModID string `json:"mod_id"`
+	// Target is the directory the mod folder and .mod file are in.
+	Target      string    `json:"target"`
+	Manifest    string    `json:"manifest,omitempty"`
+	TimeUpdated int64     `json:"time_updated,omitempty"`
+	Platform    string    `json:"platform,omitempty"`
+	ModFile     bool      `json:"mod_file"`
+	Created     time.Time `json:"created"`
+
+	dir string
+}
+
+// Version describes the installed version a snapshot is taken of.
+type Version struct {
+	Manifest    string
+	TimeUpdated int64
+	Platform    string
+}
+
+// Store keeps the snapshots in <dir>/<mod id>/<snapshot id>. Files are
+// hardlinked to the installed ones where possible. That is safe as long as
+// installed files are only ever replaced by renaming a new file over them,
+// never written in place, which is what the unpacker does.
+type Store struct {
+	dir string
+	// keep is the number of snapshots kept per mod, zero keeps all.
+	keep int
+}
+
+func New(dir string, keep int) (*Store, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &Store{dir: dir, keep: keep}, nil
+}
+
+// Take snapshots the mod installed in target. It returns ErrNotInstalled
+// when target has no content folder for the mod. Snapshots beyond the
+// retention limit are removed afterwards, the oldest first.
+func (s *Store) Take(modID, target string, version Version) (*Snapshot, error) {
+	src := filepath.Join(target, modID)
+	if stat, err := os.Stat(src); err != nil || !stat.IsDir() {
+		return nil, ErrNotInstalled
+	}
+	lock, err := fslock.Acquire(filepath.Join(s.dir, modID, lockFileName))
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Unlock()
+	tmpDir, err := ioutil.TempDir(filepath.Join(s.dir, modID), ".take-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+	if err := linkTree(src, filepath.Join(tmpDir, contentDir)); err != nil {
+		return nil, err
+	}
+	snap := &Snapshot{
+		ModID:       modID,
+		Target:      target,
+		Manifest:    version.Manifest,
+		TimeUpdated: version.TimeUpdated,
+		Platform:    version.Platform,
+		Created:     time.Now().UTC(),
+	}
+	modFile := filepath.Join(target, modID+modFileExt)
+	if _, err := os.Stat(modFile); err == nil {
+		// the .mod file is small and other tools edit it in place, so it is copied
+		if err := copyFile(modFile, filepath.Join(tmpDir, modFileName)); err != nil {
+			return nil, err
+		}
+		snap.ModFile = true
+	}
+	snap.ID = s.newID(modID, snap.Created)
+	data, err := json.MarshalIndent(snap, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(filepath.Join(tmpDir, infoFileName), data, 0644); err != nil {
+		return nil, err
+	}
+	snap.dir = filepath.Join(s.dir, modID, snap.ID)
+	if err := os.Rename(tmpDir, snap.dir); err != nil {
+		return nil, err
+	}
+	if err := s.prune(modID); err != nil {
+		fmt.Printf("could not remove old snapshots of %s: %v\n", modID, err)
+	}
+	return snap, nil
+}
+
+// newID names the snapshot after its creation time, made unique with a
+// counter when several are taken within a second.
+func (s *Store) newID(modID string, created time.Time) string {
+	base := created.Format(idTimeFormat)
+	id := base
+	for i := 2; ; i++ {
+		if _, err := os.Stat(filepath.Join(s.dir, modID, id)); os.IsNotExist(err) {
+			return id
+		}
+		id = fmt.Sprintf("%s-%d", base, i)
+	}
+}
+
+// List returns the snapshots of the mod, newest first.
+func (s *Store) List(modID string) ([]*Snapshot, error) {
+	dirs, err := ioutil.ReadDir(filepath.Join(s.dir, modID))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var snaps []*Snapshot
+	for _, d := range dirs {
+		if !d.IsDir() || strings.HasPrefix(d.Name(), ".") {
+			continue
+		}
+		snap, err := readSnapshot(filepath.Join(s.dir, modID, d.Name()))
+		if err != nil {
+			fmt.Printf("skipping broken snapshot %s/%s: %v\n", modID, d.Name(), err)
+			continue
+		}
+		snaps = append(snaps, snap)
+	}
+	sort.Slice(snaps, func(i, j int) bool {
+		if !snaps[i].Created.Equal(snaps[j].Created) {
+			return snaps[i].Created.After(snaps[j].Created)
+		}
+		return snaps[i].ID > snaps[j].ID
+	})
+	return snaps, nil
+}
+
+// Get returns the snapshot of the mod with the given id.
+func (s *Store) Get(modID, id string) (*Snapshot, error) {
+	if id == "" || strings.ContainsAny(id, `/\`) || strings.HasPrefix(id, ".") {
+		return nil, ErrNoSnapshot
+	}
+	snap, err := readSnapshot(filepath.Join(s.dir, modID, id))
+	if os.IsNotExist(err) {
+		return nil, ErrNoSnapshot
+	}
+	return snap, err
+}
+
+func (s *Store) prune(modID string) error {
+	if s.keep <= 0 {
+		return nil
+	}
+	snaps, err := s.List(modID)
+	if err != nil || len(snaps) <= s.keep {
+		return err
+	}
+	for _, snap := range snaps[s.keep:] {
+		if err := os.RemoveAll(snap.dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readSnapshot(dir string) (*Snapshot, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, infoFileName))
+	if err != nil {
+		return nil, err
+	}
+	snap := &Snapshot{}
+	if err := json.Unmarshal(data, snap); err != nil {
+		return nil, err
+	}
+	snap.dir = dir
+	return snap, nil
+}
+
+// Size returns the size of the files in the snapshot. Hardlinked files are
+// counted although they share their space with the installed ones.
+func (snap *Snapshot) Size() (int64, error) {
+	var size int64
+	err := filepath.Walk(snap.dir, func(path string, f os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !f.IsDir() && f.Name() != infoFileName {
+			size += f.Size()
+		}
+		return nil
+	})
+	return size, err
+}
+
+// ContentDir returns the copy of the mod content folder.
+func (snap *Snapshot) ContentDir() string {
+	return filepath.Join(snap.dir, contentDir)
+}
+
+// Restore puts the snapshot back into its target. The content is prepared
+// next to the installed folder and swapped in with journaled renames, so the
+// target has the old or, once recovered after a crash, the restored version.
+func (snap *Snapshot) Restore() error {
+	if err := os.MkdirAll(snap.Target, 0755); err != nil {
+		return err
+	}
+	stagingDir, err := ioutil.TempDir(snap.Target, stagingPrefix+snap.ModID+"-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(stagingDir)
+	content := filepath.Join(stagingDir, snap.ModID)
+	if err := linkTree(snap.ContentDir(), content); err != nil {
+		return err
+	}
+	modFile := filepath.Join(stagingDir, snap.ModID+modFileExt)
+	if snap.ModFile {
+		if err := copyFile(filepath.Join(snap.dir, modFileName), modFile); err != nil {
+			return err
+		}
+	}
+	return journal.Swap(snap.Target, snap.ModID, stagingDir)
+}
+
+// linkTree recreates the directory tree of src in dst with hardlinks to its
+// files, copying the files which cannot be linked.
+func linkTree(src, dst string) error {
+	return filepath.Walk(src, func(path string, f os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		location := filepath.Join(dst, relPath)
+		if f.IsDir() {
+			return os.MkdirAll(location, f.Mode().Perm()|0700)
+		}
+		return linkFile(path, location)
+	})
+}
+
+func linkFile(src, dst string) error {
+	if err := os.Link(src, dst); err == nil {
+		return nil
+	}
+	return copyFile(src, dst)
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	stat, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, stat.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
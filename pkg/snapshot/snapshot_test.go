@@ -0,0 +1,105 @@
+package snapshot
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// install writes a mod with one map file of the given content into target.
+func install(t *testing.T, target, modID, content string) {
+	dir := filepath.Join(target, modID, "Maps")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	// replace the file like the unpacker does, hardlinks of older versions stay intact
+	tmp := filepath.Join(dir, ".tmp")
+	if err := ioutil.WriteFile(tmp, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, filepath.Join(dir, "Map.umap")); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(target, modID+".mod"), []byte("mod "+content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readFile(t *testing.T, location string) string {
+	data, err := ioutil.ReadFile(location)
+	assert.NoError(t, err)
+	return string(data)
+}
+
+func TestStore_TakeRestore(t *testing.T) {
+	store, err := New(t.TempDir(), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := t.TempDir()
+	_, err = store.Take("731604991", target, Version{})
+	assert.Equal(t, ErrNotInstalled, err)
+
+	install(t, target, "731604991", "v1")
+	first, err := store.Take("731604991", target, Version{Manifest: "1", TimeUpdated: 1602871337, Platform: "linux"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, first.ModFile)
+	install(t, target, "731604991", "v2")
+	assert.Equal(t, "v1", readFile(t, filepath.Join(first.ContentDir(), "Maps", "Map.umap")))
+
+	second, err := store.Take("731604991", target, Version{Manifest: "2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NotEqual(t, first.ID, second.ID)
+	install(t, target, "731604991", "v3")
+
+	got, err := store.Get("731604991", first.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "1", got.Manifest)
+	assert.Equal(t, int64(1602871337), got.TimeUpdated)
+	assert.NoError(t, got.Restore())
+	assert.Equal(t, "v1", readFile(t, filepath.Join(target, "731604991", "Maps", "Map.umap")))
+	assert.Equal(t, "mod v1", readFile(t, filepath.Join(target, "731604991.mod")))
+	leftovers, _ := filepath.Glob(filepath.Join(target, ".*"))
+	assert.Empty(t, leftovers)
+
+	_, err = store.Take("731604991", target, Version{Manifest: "3"})
+	assert.NoError(t, err)
+	snaps, err := store.List("731604991")
+	assert.NoError(t, err)
+	if assert.Len(t, snaps, 2, "the oldest snapshot is pruned") {
+		assert.Equal(t, "3", snaps[0].Manifest)
+		assert.Equal(t, "2", snaps[1].Manifest)
+	}
+	_, err = store.Get("731604991", first.ID)
+	assert.Equal(t, ErrNoSnapshot, err)
+	_, err = store.Get("731604991", "../731604991")
+	assert.Equal(t, ErrNoSnapshot, err)
+}
+
+func TestSnapshot_RestoreWithoutModFile(t *testing.T) {
+	store, err := New(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := t.TempDir()
+	install(t, target, "731604991", "v1")
+	assert.NoError(t, os.Remove(filepath.Join(target, "731604991.mod")))
+	snap, err := store.Take("731604991", target, Version{Manifest: "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.False(t, snap.ModFile)
+	install(t, target, "731604991", "v2")
+
+	assert.NoError(t, snap.Restore())
+	assert.Equal(t, "v1", readFile(t, filepath.Join(target, "731604991", "Maps", "Map.umap")))
+	_, err = os.Stat(filepath.Join(target, "731604991.mod"))
+	assert.True(t, os.IsNotExist(err), "the .mod file of the newer version is removed")
+}
@@ -0,0 +1,193 @@
+// Package state keeps amm's record of the mods and servers it installed in a
+// JSON file in the workdir.
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/d8x/amm/pkg/fslock"
+)
+
+const (
+	fileName = "state.json"
+	// schemaVersion is increased with incompatible changes of the file format.
+	schemaVersion = 1
+)
+
+// State is the content of the state file.
+type State struct {
+	Version int                `json:"version"`
+	Mods    map[string]*Mod    `json:"mods"`
+	Servers map[string]*Server `json:"servers"`
+}
+
+// Mod is a mod amm installed or unpacked at least once.
+type Mod struct {
+	ID   string `json:"id"`
+	Name string `json:"name,omitempty"`
+	// Installs are keyed by the directory the mod was installed or unpacked to.
+	Installs map[string]*Install `json:"installs"`
+}
+
+// Install describes the version of a mod in one target directory.
+type Install struct {
+	Target      string    `json:"target"`
+	Manifest    string    `json:"manifest,omitempty"`
+	TimeUpdated int64     `json:"time_updated,omitempty"`
+	ContentHash string    `json:"content_hash,omitempty"`
+	Platform    string    `json:"platform,omitempty"`
+	InstalledAt time.Time `json:"installed_at"`
+	AmmVersion  string    `json:"amm_version"`
+}
+
+// Server is an ARK server amm installed or updated with steamcmd.
+type Server struct {
+	Dir      string    `json:"dir"`
+	BuildID  string    `json:"build_id"`
+	Branch   string    `json:"branch"`
+	Platform string    `json:"platform"`
+	Updated  time.Time `json:"updated"`
+}
+
+func newState() *State {
+	return &State{
+		Version: schemaVersion,
+		Mods:    map[string]*Mod{},
+		Servers: map[string]*Server{},
+	}
+}
+
+// SetInstall records the install of a mod into install.Target. An empty
+// name keeps the known one.
+func (s *State) SetInstall(modID, name string, install Install) {
+	m, ok := s.Mods[modID]
+	if !ok {
+		m = &Mod{ID: modID, Installs: map[string]*Install{}}
+		s.Mods[modID] = m
+	}
+	if name != "" {
+		m.Name = name
+	}
+	m.Installs[install.Target] = &install
+}
+
+// RemoveInstall forgets the mod in target, mods without installs are dropped.
+func (s *State) RemoveInstall(modID, target string) {
+	m, ok := s.Mods[modID]
+	if !ok {
+		return
+	}
+	delete(m.Installs, target)
+	if len(m.Installs) == 0 {
+		delete(s.Mods, modID)
+	}
+}
+
+// Installs returns the mods installed in target by mod id.
+func (s *State) Installs(target string) map[string]*Install {
+	installs := map[string]*Install{}
+	for id, m := range s.Mods {
+		if i, ok := m.Installs[target]; ok {
+			installs[id] = i
+		}
+	}
+	return installs
+}
+
+// ModIDs returns the ids of all recorded mods in ascending order.
+func (s *State) ModIDs() []string {
+	ids := make([]string, 0, len(s.Mods))
+	for id := range s.Mods {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// DB is the state file of a workdir. Updates are serialized with a file lock
+// and written atomically, so concurrent amm runs never lose or half write
+// each other's changes.
+type DB struct {
+	path string
+}
+
+func Open(workDir string) (*DB, error) {
+	if err := os.MkdirAll(workDir, 0755); err != nil {
+		return nil, err
+	}
+	return &DB{path: filepath.Join(workDir, fileName)}, nil
+}
+
+// Read returns the current state, an empty one when there is no state file yet.
+func (db *DB) Read() (*State, error) {
+	data, err := ioutil.ReadFile(db.path)
+	if os.IsNotExist(err) {
+		return newState(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	s := newState()
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("%s: %w", db.path, err)
+	}
+	if s.Version > schemaVersion {
+		return nil, fmt.Errorf("%s was written by a newer amm, version %d", db.path, s.Version)
+	}
+	if s.Mods == nil {
+		s.Mods = map[string]*Mod{}
+	}
+	if s.Servers == nil {
+		s.Servers = map[string]*Server{}
+	}
+	return s, nil
+}
+
+// Update applies fn to the current state and writes the result. Nothing is
+// written when fn returns an error.
+func (db *DB) Update(fn func(s *State) error) error {
+	lock, err := fslock.Acquire(db.path + ".lock")
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+	s, err := db.Read()
+	if err != nil {
+		return err
+	}
+	if err := fn(s); err != nil {
+		return err
+	}
+	s.Version = schemaVersion
+	return db.write(s)
+}
+
+func (db *DB) write(s *State) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(db.path), fileName+".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), db.path)
+}
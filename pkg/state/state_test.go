@@ -0,0 +1,102 @@
+package state
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_Update(t *testing.T) {
+	db, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := db.Read()
+	assert.NoError(t, err)
+	assert.Empty(t, s.Mods)
+
+	installedAt := time.Date(2020, 10, 16, 18, 2, 17, 0, time.UTC)
+	err = db.Update(func(s *State) error {
+		s.SetInstall("731604991", "Structures Plus (S+)", Install{
+			Target:      "/srv/ark/ShooterGame/Content/Mods",
+			Manifest:    "4893014226545467381",
+			TimeUpdated: 1602871337,
+			ContentHash: "abc",
+			Platform:    "linux",
+			InstalledAt: installedAt,
+			AmmVersion:  "dev",
+		})
+		s.SetInstall("731604991", "", Install{Target: "/tmp/unpacked", InstalledAt: installedAt})
+		return nil
+	})
+	assert.NoError(t, err)
+
+	s, err = db.Read()
+	assert.NoError(t, err)
+	assert.Equal(t, "Structures Plus (S+)", s.Mods["731604991"].Name)
+	assert.Len(t, s.Mods["731604991"].Installs, 2)
+	installs := s.Installs("/srv/ark/ShooterGame/Content/Mods")
+	if assert.Contains(t, installs, "731604991") {
+		assert.Equal(t, "4893014226545467381", installs["731604991"].Manifest)
+		assert.True(t, installedAt.Equal(installs["731604991"].InstalledAt))
+	}
+
+	failed := errors.New("failed")
+	err = db.Update(func(s *State) error {
+		s.RemoveInstall("731604991", "/tmp/unpacked")
+		return failed
+	})
+	assert.Equal(t, failed, err)
+	s, _ = db.Read()
+	assert.Len(t, s.Mods["731604991"].Installs, 2, "failed updates are not written")
+
+	assert.NoError(t, db.Update(func(s *State) error {
+		s.RemoveInstall("731604991", "/tmp/unpacked")
+		s.RemoveInstall("731604991", "/srv/ark/ShooterGame/Content/Mods")
+		return nil
+	}))
+	s, _ = db.Read()
+	assert.Empty(t, s.ModIDs())
+}
+
+func TestDB_UpdateConcurrent(t *testing.T) {
+	dir := t.TempDir()
+	wg := sync.WaitGroup{}
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// every update opens its own DB like separate amm runs do
+			db, err := Open(dir)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			err = db.Update(func(s *State) error {
+				s.SetInstall(string(rune('a'+i)), "", Install{Target: "mods"})
+				return nil
+			})
+			assert.NoError(t, err)
+		}(i)
+	}
+	wg.Wait()
+	db, _ := Open(dir)
+	s, err := db.Read()
+	assert.NoError(t, err)
+	assert.Len(t, s.Mods, 20)
+}
+
+func TestDB_ReadNewerVersion(t *testing.T) {
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, fileName), []byte(`{"version": 99}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	db, _ := Open(dir)
+	_, err := db.Read()
+	assert.Error(t, err)
+}
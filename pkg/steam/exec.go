@@ -0,0 +1,44 @@
+package steam
+
+import (
+	"context"
+	"io"
+	"os"
+	"os/exec"
+)
+
+// runSteamCMD runs steamcmd with the given arguments and environment. When ctx is done the
+// whole steamcmd process tree is killed, steamcmd.sh on linux forks the real
+// binary so killing only the direct child is not enough.
+func (s *SteamHandler) runSteamCMD(ctx context.Context, env []string, args ...string) error {
+	return s.runSteamCMDOutput(ctx, env, os.Stdout, args...)
+}
+
+// runSteamCMDOutput is runSteamCMD writing the output of steamcmd to stdout.
+func (s *SteamHandler) runSteamCMDOutput(ctx context.Context, env []string, stdout io.Writer, args ...string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	c := exec.Command(s.CMDLocation, args...)
+	c.Stderr = os.Stderr
+	c.Stdout = stdout
+	c.Env = env
+	setProcessGroup(c)
+	if err := c.Start(); err != nil {
+		return err
+	}
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			killProcessTree(c.Process)
+		case <-done:
+		}
+	}()
+	err := c.Wait()
+	close(done)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
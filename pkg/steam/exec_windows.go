@@ -0,0 +1,18 @@
+//go:build windows
+// +build windows
+
+package steam
+
+import (
+	"os"
+	"os/exec"
+	"strconv"
+)
+
+func setProcessGroup(c *exec.Cmd) {}
+
+func killProcessTree(p *os.Process) {
+	if err := exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(p.Pid)).Run(); err != nil {
+		p.Kill()
+	}
+}
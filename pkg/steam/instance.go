@@ -0,0 +1,148 @@
+package steam
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/d8x/amm/pkg/fslock"
+	"github.com/d8x/amm/pkg/vdf"
+)
+
+// instance is an isolated, persistent steamcmd environment in the workdir.
+// Every instance has its own HOME, where steamcmd keeps its login state, and
+// its own force_install_dir with the downloaded content and the workshop
+// state file, so several steamcmd processes can run side by side and later
+// downloads only fetch what changed. An instance is used by one process at a
+// time, which is guarded by a lock file next to it.
+// On windows steamcmd keeps its state next to the executable and only the
+// install dir is isolated.
+type instance struct {
+	dir    string
+	gameID string
+	lock   *fslock.Lock
+}
+
+// acquireInstance locks the first free instance of the workdir and creates it
+// if it does not exist yet.
+func (s *SteamHandler) acquireInstance() (*instance, error) {
+	for n := 0; ; n++ {
+		dir := filepath.Join(s.workDir, instancesDirName, strconv.Itoa(n))
+		lock, err := fslock.TryAcquire(dir + ".lock")
+		if err == fslock.ErrLocked {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return s.newInstance(dir, lock)
+	}
+}
+
+// waitInstance blocks until the existing instance in dir is free.
+func (s *SteamHandler) waitInstance(dir string) (*instance, error) {
+	lock, err := fslock.Acquire(dir + ".lock")
+	if err != nil {
+		return nil, err
+	}
+	return s.newInstance(dir, lock)
+}
+
+// instanceDirs lists the instances created in the workdir so far.
+func (s *SteamHandler) instanceDirs() ([]string, error) {
+	entries, err := ioutil.ReadDir(filepath.Join(s.workDir, instancesDirName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var dirs []string
+	for _, e := range entries {
+		if e.IsDir() {
+			dirs = append(dirs, filepath.Join(s.workDir, instancesDirName, e.Name()))
+		}
+	}
+	return dirs, nil
+}
+
+func (s *SteamHandler) newInstance(dir string, lock *fslock.Lock) (*instance, error) {
+	inst := &instance{dir: dir, gameID: s.cfg.GameID, lock: lock}
+	for _, d := range []string{inst.homeDir(), inst.installDir(HostPlatform())} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			inst.close()
+			return nil, err
+		}
+	}
+	return inst, nil
+}
+
+func (i *instance) homeDir() string {
+	return filepath.Join(i.dir, "home")
+}
+
+// installDir is where steamcmd keeps the content of the platform. Every
+// platform needs its own dir, steamcmd would otherwise take the content of
+// the other platform as up to date.
+func (i *instance) installDir(platform string) string {
+	if platform == HostPlatform() {
+		return filepath.Join(i.dir, "install")
+	}
+	return filepath.Join(i.dir, "install-"+platform)
+}
+
+// appWorkshopFile is steamcmd's state of the workshop items of the game.
+func (i *instance) appWorkshopFile(platform string) string {
+	return filepath.Join(i.installDir(platform), "steamapps", "workshop", "appworkshop_"+i.gameID+".acf")
+}
+
+func (i *instance) env() []string {
+	return append(os.Environ(), "HOME="+i.homeDir())
+}
+
+// installedItem returns steamcmd's record of the mod in this instance.
+func (i *instance) installedItem(modID, platform string) (vdf.WorkshopItemInstalled, error) {
+	a, err := vdf.ReadAppWorkshopFile(i.appWorkshopFile(platform))
+	if err != nil {
+		return vdf.WorkshopItemInstalled{}, err
+	}
+	item, ok := a.WorkshopItemsInstalled[modID]
+	if !ok {
+		return vdf.WorkshopItemInstalled{}, vdf.ErrNotFound
+	}
+	return item, nil
+}
+
+func (i *instance) close() {
+	i.lock.Unlock()
+}
+
+// InstalledItems returns the workshop items steamcmd has on disk, read from
+// the workshop state files of every instance and platform in the workdir.
+// When an item was downloaded several times the most recently updated one is
+// returned.
+func (s *SteamHandler) InstalledItems() (map[string]vdf.WorkshopItemInstalled, error) {
+	dirs, err := s.instanceDirs()
+	if err != nil {
+		return nil, err
+	}
+	items := map[string]vdf.WorkshopItemInstalled{}
+	for _, dir := range dirs {
+		for _, platform := range Platforms {
+			a, err := vdf.ReadAppWorkshopFile((&instance{dir: dir, gameID: s.cfg.GameID}).appWorkshopFile(platform))
+			if os.IsNotExist(err) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			for id, item := range a.WorkshopItemsInstalled {
+				if known, ok := items[id]; !ok || item.TimeUpdated > known.TimeUpdated {
+					items[id] = item
+				}
+			}
+		}
+	}
+	return items, nil
+}
@@ -0,0 +1,144 @@
+package steam
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Login is a steam account steamcmd logs in with instead of anonymous.
+type Login struct {
+	Username string
+	// Password looks up the password, it is only asked for when an instance
+	// has no cached login token yet.
+	Password func(username string) (string, error)
+	// GuardCode is the Steam Guard code used for logins with password.
+	GuardCode string
+	// PromptGuardCode asks for a Steam Guard code when GuardCode is empty,
+	// nil logs in without one.
+	PromptGuardCode func(username string) (string, error)
+
+	mu sync.Mutex
+}
+
+// guardCode returns the Steam Guard code, it is asked for at most once.
+func (l *Login) guardCode() (string, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.GuardCode != "" || l.PromptGuardCode == nil {
+		return l.GuardCode, nil
+	}
+	code, err := l.PromptGuardCode(l.Username)
+	if err != nil {
+		return "", err
+	}
+	l.GuardCode = strings.TrimSpace(code)
+	return l.GuardCode, nil
+}
+
+// runLoggedIn runs the steamcmd commands after logging in, see runLoggedInOutput.
+func (s *SteamHandler) runLoggedIn(ctx context.Context, inst *instance, before []string, commands ...string) error {
+	return s.runLoggedInOutput(ctx, inst, os.Stdout, before, commands...)
+}
+
+// runLoggedInOutput runs the steamcmd commands after logging in. before are the
+// options which have to be set before the login. The password is passed in a
+// script file only the user can read, so it never shows up in the steamcmd
+// command line. Once a login with password succeeded steamcmd keeps a login
+// token in the instance, which is used from then on.
+func (s *SteamHandler) runLoggedInOutput(ctx context.Context, inst *instance, stdout io.Writer, before []string, commands ...string) error {
+	if s.Login == nil {
+		return s.runSteamCMDOutput(ctx, inst.env(), stdout, joinArgs(before, []string{"+login", "anonymous"}, commands)...)
+	}
+	username := s.Login.Username
+	before = append([]string{"+@NoPromptForPassword", "1"}, before...)
+	if inst.hasLoginToken(username) {
+		err := s.runSteamCMDOutput(ctx, inst.env(), stdout, joinArgs(before, []string{"+login", username}, commands)...)
+		if err == nil || ctx.Err() != nil {
+			return err
+		}
+		fmt.Printf("steamcmd failed with the cached login of %s, logging in with password: %v\n", username, err)
+		inst.removeLoginToken(username)
+	}
+	script, err := s.writeLoginScript(inst)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(script)
+	if err := s.runSteamCMDOutput(ctx, inst.env(), stdout, joinArgs(before, []string{"+runscript", script}, commands)...); err != nil {
+		return err
+	}
+	inst.saveLoginToken(username)
+	return nil
+}
+
+func (s *SteamHandler) writeLoginScript(inst *instance) (string, error) {
+	if s.Login.Password == nil {
+		return "", fmt.Errorf("no password for steam account %s", s.Login.Username)
+	}
+	password, err := s.Login.Password(s.Login.Username)
+	if err != nil {
+		return "", err
+	}
+	code, err := s.Login.guardCode()
+	if err != nil {
+		return "", err
+	}
+	f, err := ioutil.TempFile(inst.homeDir(), ".login-")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if err := f.Chmod(0600); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	line := fmt.Sprintf("login %s %s %s", quoteScriptArg(s.Login.Username), quoteScriptArg(password), quoteScriptArg(code))
+	if _, err := fmt.Fprintln(f, strings.TrimSpace(line)); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// quoteScriptArg quotes arguments of steamcmd script lines containing spaces.
+func quoteScriptArg(arg string) string {
+	if arg == "" || !strings.ContainsAny(arg, " \t\"") {
+		return arg
+	}
+	return `"` + strings.Replace(arg, `"`, `\"`, -1) + `"`
+}
+
+func (i *instance) loginTokenFile(username string) string {
+	return filepath.Join(i.dir, "login-"+filepath.Base(strings.ToLower(username)))
+}
+
+// hasLoginToken reports whether steamcmd logged in the user with password in
+// this instance before and so has a login token.
+func (i *instance) hasLoginToken(username string) bool {
+	_, err := os.Stat(i.loginTokenFile(username))
+	return err == nil
+}
+
+func (i *instance) saveLoginToken(username string) {
+	if err := ioutil.WriteFile(i.loginTokenFile(username), nil, 0600); err != nil {
+		fmt.Printf("could not record the login of %s: %v\n", username, err)
+	}
+}
+
+func (i *instance) removeLoginToken(username string) {
+	os.Remove(i.loginTokenFile(username))
+}
+
+func joinArgs(groups ...[]string) []string {
+	var args []string
+	for _, g := range groups {
+		args = append(args, g...)
+	}
+	return args
+}
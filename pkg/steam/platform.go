@@ -0,0 +1,51 @@
+package steam
+
+import (
+	"fmt"
+	"runtime"
+)
+
+const (
+	PlatformWindows = "windows"
+	PlatformLinux   = "linux"
+	// forcePlatformOption makes steamcmd download the content of another platform.
+	forcePlatformOption = "+@sSteamCmdForcePlatformType"
+)
+
+// Platforms are the platforms ARK servers run on.
+var Platforms = []string{PlatformWindows, PlatformLinux}
+
+// HostPlatform is the platform steamcmd downloads content for by default.
+func HostPlatform() string {
+	return runtime.GOOS
+}
+
+// ValidatePlatform accepts the known platforms and the empty string, which
+// stands for the host platform.
+func ValidatePlatform(platform string) error {
+	if platform == "" {
+		return nil
+	}
+	for _, p := range Platforms {
+		if p == platform {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown platform %q, expected windows or linux", platform)
+}
+
+func resolvePlatform(platform string) string {
+	if platform == "" {
+		return HostPlatform()
+	}
+	return platform
+}
+
+// platformArgs are the steamcmd options selecting the content platform. They
+// have to come before +login.
+func platformArgs(platform string) []string {
+	if platform == HostPlatform() {
+		return nil
+	}
+	return []string{forcePlatformOption, platform}
+}
@@ -0,0 +1,157 @@
+package steam
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/d8x/amm/pkg/cache"
+	"github.com/d8x/amm/pkg/vdf"
+)
+
+// DownloadResult is reported by the Scheduler for every mod it processed.
+type DownloadResult struct {
+	ModID    string
+	Location string
+	// Item is steamcmd's record of the downloaded version.
+	Item vdf.WorkshopItemInstalled
+	// Platform is the platform the content was downloaded for.
+	Platform string
+	// ContentHash identifies the raw content, see cache.HashDir.
+	ContentHash string
+	// Cached is set when the version was already cached and not downloaded again.
+	Cached bool
+	Err    error
+}
+
+// Scheduler downloads mods with several steamcmd processes in parallel. Each
+// worker runs its own isolated steamcmd instance and takes the next mod from
+// a shared queue as soon as it is done with the previous one.
+type Scheduler struct {
+	handler     *SteamHandler
+	concurrency int
+	// Manifests holds the current workshop manifest of mods, when known. A
+	// mod whose current version is cached is not downloaded again.
+	Manifests map[string]string
+	// Platform selects the content platform, empty is the host platform.
+	Platform string
+}
+
+func NewScheduler(handler *SteamHandler, concurrency int) *Scheduler {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	return &Scheduler{
+		handler:     handler,
+		concurrency: concurrency,
+	}
+}
+
+// Download starts downloading modIDs and returns a channel with one result per
+// mod, in the order the downloads finish. The channel is closed once all
+// workers stopped. Mods which were not started before ctx got cancelled are
+// reported with the context error. The channel holds every result, so the
+// workers keep downloading while the caller unpacks earlier mods.
+func (s *Scheduler) Download(ctx context.Context, modIDs []string) <-chan DownloadResult {
+	results := make(chan DownloadResult, len(modIDs))
+	go func() {
+		defer close(results)
+		if s.handler.Offline {
+			for _, modID := range modIDs {
+				results <- s.cachedResult(modID)
+			}
+			return
+		}
+		if err := s.handler.setSteamCMDPath(); err != nil {
+			for _, modID := range modIDs {
+				results <- DownloadResult{ModID: modID, Err: err}
+			}
+			return
+		}
+		queue := make(chan string, len(modIDs))
+		for _, modID := range modIDs {
+			queue <- modID
+		}
+		close(queue)
+		wg := sync.WaitGroup{}
+		for i := 0; i < s.concurrency && i < len(modIDs); i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				s.work(ctx, queue, results)
+			}()
+		}
+		wg.Wait()
+	}()
+	return results
+}
+
+func (s *Scheduler) work(ctx context.Context, queue <-chan string, results chan<- DownloadResult) {
+	inst, err := s.handler.acquireInstance()
+	if err != nil {
+		for modID := range queue {
+			results <- DownloadResult{ModID: modID, Err: err}
+		}
+		return
+	}
+	defer inst.close()
+	for modID := range queue {
+		if err := ctx.Err(); err != nil {
+			results <- DownloadResult{ModID: modID, Err: err}
+			continue
+		}
+		if entry, err := s.handler.cache.Lookup(modID, s.Manifests[modID], s.platform()); err == nil {
+			results <- entryResult(entry, true)
+			continue
+		}
+		entry, err := s.handler.downloadMod(ctx, inst, modID, s.platform())
+		if err != nil {
+			results <- DownloadResult{ModID: modID, Err: err}
+			continue
+		}
+		results <- entryResult(entry, false)
+	}
+}
+
+// cachedResult serves the mod from the cache without asking steamcmd. The
+// current version is used when known, otherwise the newest cached one.
+func (s *Scheduler) cachedResult(modID string) DownloadResult {
+	var entry *cache.Entry
+	var err error
+	if manifest := s.Manifests[modID]; manifest != "" {
+		entry, err = s.handler.cache.Lookup(modID, manifest, s.platform())
+		if errors.Is(err, cache.ErrNotCached) {
+			err = fmt.Errorf("%w: mod %s manifest %s for %s", err, modID, manifest, s.platform())
+		}
+	} else {
+		entry, err = s.handler.cache.Latest(modID, s.platform())
+		if errors.Is(err, cache.ErrNotCached) {
+			err = fmt.Errorf("%w: mod %s for %s", err, modID, s.platform())
+		}
+	}
+	if err != nil {
+		return DownloadResult{ModID: modID, Err: err}
+	}
+	return entryResult(entry, true)
+}
+
+func (s *Scheduler) platform() string {
+	return resolvePlatform(s.Platform)
+}
+
+func entryResult(entry *cache.Entry, cached bool) DownloadResult {
+	return DownloadResult{
+		ModID:    entry.ModID,
+		Location: entry.Path(),
+		Item: vdf.WorkshopItemInstalled{
+			ID:          entry.ModID,
+			Size:        entry.Size,
+			TimeUpdated: entry.TimeUpdated,
+			Manifest:    entry.Manifest,
+		},
+		Platform:    entry.Platform,
+		ContentHash: entry.ContentHash,
+		Cached:      cached,
+	}
+}
@@ -0,0 +1,271 @@
+package steam
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/d8x/amm/pkg/cache"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeSteamCMD puts a steamcmd script on PATH which "downloads" a workshop
+// item by writing the HOME it was started with, the forced platform, its
+// arguments and the login script into the item's content dir and recording
+// the item in the workshop state file. app_update writes an appmanifest and
+// app_info_print prints a public build.
+func fakeSteamCMD(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake steamcmd is a shell script")
+	}
+	binDir := t.TempDir()
+	script := `#!/bin/sh
+args="$*"
+while [ $# -gt 0 ]; do
+	case "$1" in
+	+runscript) login="$(cat "$2")"; shift ;;
+	+@sSteamCmdForcePlatformType) platform="$2"; shift ;;
+	+force_install_dir) dir="$2"; shift ;;
+	+app_update) app="$2"; shift ;;
+	-beta) beta="$2"; shift ;;
+	+app_info_print) info="$2"; shift ;;
+	+workshop_download_item) mod="$3"; shift; shift ;;
+	esac
+	shift
+done
+if [ -n "$app" ]; then
+	mkdir -p "$dir/steamapps"
+	printf '"AppState"\n{\n\t"appid"\t"%s"\n\t"buildid"\t"5863244"\n\t"UserConfig"\n\t{\n\t\t"betakey"\t"%s"\n\t}\n}\n' "$app" "$beta" > "$dir/steamapps/appmanifest_$app.acf"
+	echo "$args" > "$dir/args"
+	exit 0
+fi
+if [ -n "$info" ]; then
+	printf 'AppID : %s, change number : 10144513\n"%s"\n{\n\t"depots"\n\t{\n\t\t"branches"\n\t\t{\n\t\t\t"public"\n\t\t\t{\n\t\t\t\t"buildid"\t"6012853"\n\t\t\t}\n\t\t}\n\t}\n}\nUnloading Steam API...OK\n' "$info" "$info"
+	exit 0
+fi
+mkdir -p "$dir/steamapps/workshop/content/346110/$mod"
+echo "$HOME" > "$dir/steamapps/workshop/content/346110/$mod/home"
+echo "$platform" > "$dir/steamapps/workshop/content/346110/$mod/platform"
+echo "$args" > "$dir/steamapps/workshop/content/346110/$mod/args"
+echo "$login" > "$dir/steamapps/workshop/content/346110/$mod/login"
+cat > "$dir/steamapps/workshop/appworkshop_346110.acf" <<EOF
+"AppWorkshop"
+{
+	"appid"		"346110"
+	"WorkshopItemsInstalled"
+	{
+		"$mod"
+		{
+			"size"		"4"
+			"timeupdated"		"1602871337"
+			"manifest"		"4893014226545467381"
+		}
+	}
+}
+EOF
+`
+	if err := ioutil.WriteFile(filepath.Join(binDir, "steamcmd"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	path := os.Getenv("PATH")
+	os.Setenv("PATH", binDir+string(os.PathListSeparator)+path)
+	t.Cleanup(func() { os.Setenv("PATH", path) })
+}
+
+func TestScheduler_Download(t *testing.T) {
+	fakeSteamCMD(t)
+	workDir := t.TempDir()
+	handler, err := NewSteamHandler(workDir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	modIDs := []string{"731604991", "751991809", "812655342", "889745138"}
+
+	var downloaded []string
+	homes := map[string]bool{}
+	for result := range NewScheduler(handler, 2).Download(context.Background(), modIDs) {
+		if !assert.NoError(t, result.Err) {
+			continue
+		}
+		assert.Equal(t, filepath.Join(workDir, cacheDirName, result.ModID, "4893014226545467381-"+HostPlatform(), result.ModID), result.Location)
+		assert.False(t, result.Cached)
+		home, err := ioutil.ReadFile(filepath.Join(result.Location, "home"))
+		assert.NoError(t, err)
+		homes[string(home)] = true
+		assert.Equal(t, int64(1602871337), result.Item.TimeUpdated)
+		downloaded = append(downloaded, result.ModID)
+	}
+	sort.Strings(downloaded)
+	assert.Equal(t, modIDs, downloaded)
+	assert.True(t, len(homes) <= 2, "every worker should use one steamcmd home")
+	for home := range homes {
+		assert.Contains(t, home, filepath.Join(workDir, instancesDirName))
+	}
+	items, err := handler.InstalledItems()
+	assert.NoError(t, err)
+	// the fake only records the last item per instance
+	assert.NotEmpty(t, items)
+	for _, item := range items {
+		assert.Equal(t, "4893014226545467381", item.Manifest)
+	}
+}
+
+func TestScheduler_DownloadWhileBusy(t *testing.T) {
+	fakeSteamCMD(t)
+	handler, err := NewSteamHandler(t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	modIDs := []string{"731604991", "751991809", "812655342"}
+	// the results are not read, like while the caller unpacks a large mod
+	results := NewScheduler(handler, 1).Download(context.Background(), modIDs)
+	deadline := time.Now().Add(10 * time.Second)
+	for len(results) < len(modIDs) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Len(t, results, len(modIDs), "every mod is downloaded without waiting for the caller")
+	for result := range results {
+		assert.NoError(t, result.Err)
+	}
+}
+
+func TestScheduler_DownloadCached(t *testing.T) {
+	fakeSteamCMD(t)
+	handler, err := NewSteamHandler(t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	modIDs := []string{"731604991", "889745138"}
+	for range NewScheduler(handler, 1).Download(context.Background(), modIDs) {
+	}
+	scheduler := NewScheduler(handler, 1)
+	scheduler.Manifests = map[string]string{"731604991": "4893014226545467381", "889745138": "1"}
+	cached := map[string]bool{}
+	for result := range scheduler.Download(context.Background(), modIDs) {
+		assert.NoError(t, result.Err)
+		cached[result.ModID] = result.Cached
+	}
+	assert.Equal(t, map[string]bool{"731604991": true, "889745138": false}, cached)
+}
+
+func TestScheduler_DownloadPlatform(t *testing.T) {
+	fakeSteamCMD(t)
+	handler, err := NewSteamHandler(t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := PlatformWindows
+	if HostPlatform() == PlatformWindows {
+		other = PlatformLinux
+	}
+	for _, platform := range []string{"", other} {
+		scheduler := NewScheduler(handler, 1)
+		scheduler.Platform = platform
+		for result := range scheduler.Download(context.Background(), []string{"731604991"}) {
+			if !assert.NoError(t, result.Err) {
+				continue
+			}
+			assert.Equal(t, resolvePlatform(platform), result.Platform)
+			assert.False(t, result.Cached, "platforms are cached apart")
+			forced, err := ioutil.ReadFile(filepath.Join(result.Location, "platform"))
+			assert.NoError(t, err)
+			assert.Equal(t, platform+"\n", string(forced))
+		}
+	}
+	versions, err := handler.Cache().Versions("731604991")
+	assert.NoError(t, err)
+	assert.Len(t, versions, 2)
+}
+
+func TestScheduler_DownloadLogin(t *testing.T) {
+	fakeSteamCMD(t)
+	handler, err := NewSteamHandler(t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prompts := 0
+	handler.Login = &Login{
+		Username: "survivor",
+		Password: func(string) (string, error) { return "hunter 2", nil },
+		PromptGuardCode: func(string) (string, error) {
+			prompts++
+			return "F4K3C\n", nil
+		},
+	}
+	readFile := func(location string) string {
+		data, err := ioutil.ReadFile(location)
+		assert.NoError(t, err)
+		return string(data)
+	}
+	for i, modID := range []string{"731604991", "889745138"} {
+		for result := range NewScheduler(handler, 1).Download(context.Background(), []string{modID}) {
+			if !assert.NoError(t, result.Err) {
+				continue
+			}
+			args := readFile(filepath.Join(result.Location, "args"))
+			assert.NotContains(t, args, "hunter")
+			if i == 0 {
+				assert.Contains(t, args, "+runscript")
+				assert.Equal(t, "login survivor \"hunter 2\" F4K3C\n", readFile(filepath.Join(result.Location, "login")))
+			} else {
+				assert.Contains(t, args, "+login survivor +force_install_dir", "cached login token is used")
+			}
+		}
+	}
+	assert.Equal(t, 1, prompts)
+	scripts, _ := filepath.Glob(filepath.Join(handler.workDir, instancesDirName, "*", "home", ".login-*"))
+	assert.Empty(t, scripts, "login scripts are removed")
+}
+
+func TestScheduler_DownloadCancelled(t *testing.T) {
+	fakeSteamCMD(t)
+	handler, err := NewSteamHandler(t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	count := 0
+	for result := range NewScheduler(handler, 3).Download(ctx, []string{"731604991", "751991809"}) {
+		assert.Equal(t, context.Canceled, result.Err)
+		count++
+	}
+	assert.Equal(t, 2, count)
+}
+
+func TestScheduler_DownloadOffline(t *testing.T) {
+	handler, err := NewSteamHandler(t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := filepath.Join(t.TempDir(), "731604991")
+	if err := os.MkdirAll(src, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(src, "mod.info"), []byte("info"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := handler.Cache().Add("731604991", src, "4893014226545467381", HostPlatform(), 1602871337); err != nil {
+		t.Fatal(err)
+	}
+	// steamcmd is not on PATH, offline mode must not need it
+	handler.Offline = true
+	scheduler := NewScheduler(handler, 2)
+	scheduler.Manifests = map[string]string{"889745138": "1"}
+	results := map[string]DownloadResult{}
+	for result := range scheduler.Download(context.Background(), []string{"731604991", "889745138", "751991809"}) {
+		results[result.ModID] = result
+	}
+	assert.NoError(t, results["731604991"].Err)
+	assert.True(t, results["731604991"].Cached)
+	assert.Equal(t, "4893014226545467381", results["731604991"].Item.Manifest)
+	assert.True(t, errors.Is(results["889745138"].Err, cache.ErrNotCached))
+	assert.True(t, errors.Is(results["751991809"].Err, cache.ErrNotCached))
+	assert.True(t, errors.Is(handler.DownloadCMD(context.Background(), CMDDownloadOptions{}), ErrOffline))
+}
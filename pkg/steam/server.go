@@ -0,0 +1,133 @@
+package steam
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/d8x/amm/pkg/vdf"
+)
+
+const (
+	// ServerAppID is the ARK dedicated server app.
+	ServerAppID       = "376030"
+	serverAppManifest = "steamapps/appmanifest_" + ServerAppID + ".acf"
+)
+
+var ErrServerNotInstalled = errors.New("no ARK server installed by steamcmd, appmanifest is missing")
+
+// ServerOptions selects the ARK server install steamcmd works on.
+type ServerOptions struct {
+	Dir string
+	// Beta is the branch to install, empty is the public branch.
+	Beta string
+	// Validate makes steamcmd check all files and repair broken ones.
+	Validate bool
+	// Platform selects the server binaries, empty is the host platform.
+	Platform string
+}
+
+// UpdateServer installs or updates the ARK server in opts.Dir with
+// app_update and returns the installed state.
+func (s *SteamHandler) UpdateServer(ctx context.Context, opts ServerOptions) (*vdf.AppState, error) {
+	if err := s.setSteamCMDPath(); err != nil {
+		return nil, err
+	}
+	dir, err := filepath.Abs(opts.Dir)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	inst, err := s.acquireInstance()
+	if err != nil {
+		return nil, err
+	}
+	defer inst.close()
+	platform := resolvePlatform(opts.Platform)
+	commands := []string{"+force_install_dir", dir, "+app_update", ServerAppID}
+	if opts.Beta != "" {
+		commands = append(commands, "-beta", opts.Beta)
+	}
+	if opts.Validate {
+		commands = append(commands, "validate")
+	}
+	commands = append(commands, "+quit")
+	if err := s.runLoggedIn(ctx, inst, platformArgs(platform), commands...); err != nil {
+		return nil, err
+	}
+	return ReadServerState(dir)
+}
+
+// ReadServerState reads the appmanifest steamcmd keeps in the server dir.
+func ReadServerState(dir string) (*vdf.AppState, error) {
+	state, err := vdf.ReadAppManifestFile(filepath.Join(dir, serverAppManifest))
+	if os.IsNotExist(err) {
+		return nil, ErrServerNotInstalled
+	}
+	return state, err
+}
+
+// LatestServerBuild asks steam for the current build id of the branch.
+func (s *SteamHandler) LatestServerBuild(ctx context.Context, branch, platform string) (string, error) {
+	if err := s.setSteamCMDPath(); err != nil {
+		return "", err
+	}
+	inst, err := s.acquireInstance()
+	if err != nil {
+		return "", err
+	}
+	defer inst.close()
+	out := &bytes.Buffer{}
+	err = s.runLoggedInOutput(ctx, inst, out, platformArgs(resolvePlatform(platform)),
+		"+app_info_update", "1", "+app_info_print", ServerAppID, "+quit")
+	if err != nil {
+		return "", err
+	}
+	appInfo, err := parseAppInfo(out.Bytes(), ServerAppID)
+	if err != nil {
+		return "", err
+	}
+	return vdf.BranchBuildID(appInfo, branch)
+}
+
+// parseAppInfo finds the app section in the output of app_info_print, which
+// is mixed with the other output of steamcmd.
+func parseAppInfo(out []byte, appID string) (*vdf.Node, error) {
+	var section []string
+	depth := 0
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if section == nil {
+			if line == `"`+appID+`"` {
+				section = []string{line}
+			}
+			continue
+		}
+		section = append(section, line)
+		switch line {
+		case "{":
+			depth++
+		case "}":
+			depth--
+		}
+		if depth == 0 && line == "}" {
+			doc, err := vdf.Parse(strings.NewReader(strings.Join(section, "\n")))
+			if err != nil {
+				return nil, err
+			}
+			return doc.Child(appID), nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("%w: app info of %s in steamcmd output", vdf.ErrNotFound, appID)
+}
@@ -0,0 +1,37 @@
+package steam
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSteamHandler_UpdateServer(t *testing.T) {
+	fakeSteamCMD(t)
+	handler, err := NewSteamHandler(t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Join(t.TempDir(), "ark")
+	_, err = ReadServerState(dir)
+	assert.Equal(t, ErrServerNotInstalled, err)
+
+	state, err := handler.UpdateServer(context.Background(), ServerOptions{Dir: dir, Beta: "preaquatica", Validate: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "5863244", state.BuildID)
+	assert.Equal(t, "preaquatica", state.BetaKey)
+	args, err := ioutil.ReadFile(filepath.Join(dir, "args"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(args), "+app_update 376030 -beta preaquatica validate +quit")
+
+	latest, err := handler.LatestServerBuild(context.Background(), "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "6012853", latest)
+	_, err = handler.LatestServerBuild(context.Background(), "preaquatica", "")
+	assert.Error(t, err)
+}
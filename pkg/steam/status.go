@@ -0,0 +1,76 @@
+package steam
+
+import (
+	"context"
+	"os"
+
+	"github.com/d8x/amm/pkg/update"
+	"github.com/d8x/amm/pkg/vdf"
+)
+
+// WorkshopStatusSource looks up the latest published mod versions with
+// steamcmd's workshop_status command. steamcmd stores what it learned in the
+// WorkshopItemDetails of each instance's workshop state file, so only mods
+// downloaded through the workdir can be looked up.
+type WorkshopStatusSource struct {
+	handler *SteamHandler
+}
+
+func NewWorkshopStatusSource(handler *SteamHandler) *WorkshopStatusSource {
+	return &WorkshopStatusSource{handler: handler}
+}
+
+func (w *WorkshopStatusSource) Latest(ctx context.Context, modIDs []string) (map[string]update.Version, error) {
+	if err := w.handler.setSteamCMDPath(); err != nil {
+		return nil, err
+	}
+	dirs, err := w.handler.instanceDirs()
+	if err != nil {
+		return nil, err
+	}
+	wanted := map[string]bool{}
+	for _, id := range modIDs {
+		wanted[id] = true
+	}
+	latest := map[string]update.Version{}
+	for _, dir := range dirs {
+		details, err := w.refreshInstance(ctx, dir)
+		if err != nil {
+			return nil, err
+		}
+		for id, d := range details {
+			if !wanted[id] {
+				continue
+			}
+			v := update.Version{TimeUpdated: d.LatestTimeUpdated, Manifest: d.LatestManifest}
+			// steamcmd leaves out the latest_ keys when the installed version is the latest one
+			if v.TimeUpdated == 0 {
+				v = update.Version{TimeUpdated: d.TimeUpdated, Manifest: d.Manifest}
+			}
+			if known, ok := latest[id]; !ok || v.TimeUpdated > known.TimeUpdated {
+				latest[id] = v
+			}
+		}
+	}
+	return latest, nil
+}
+
+func (w *WorkshopStatusSource) refreshInstance(ctx context.Context, dir string) (map[string]vdf.WorkshopItemDetails, error) {
+	inst, err := w.handler.waitInstance(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer inst.close()
+	if _, err := os.Stat(inst.appWorkshopFile(HostPlatform())); os.IsNotExist(err) {
+		return nil, nil
+	}
+	err = w.handler.runLoggedIn(ctx, inst, nil, "+force_install_dir", inst.installDir(HostPlatform()), "+workshop_status", w.handler.cfg.GameID, "+quit")
+	if err != nil {
+		return nil, err
+	}
+	a, err := vdf.ReadAppWorkshopFile(inst.appWorkshopFile(HostPlatform()))
+	if err != nil {
+		return nil, err
+	}
+	return a.WorkshopItemDetails, nil
+}
@@ -4,89 +4,117 @@ import (
 	"archive/tar"
 	"archive/zip"
 	"compress/gzip"
+	"context"
 	"errors"
 	"fmt"
-	"github.com/otiai10/copy"
+	"github.com/d8x/amm/pkg/cache"
+	"github.com/d8x/amm/pkg/config"
 	"io"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
 	"runtime"
 )
 
 const (
-	tmpSteamLocation   = "./steam"
-	windowsSteamCMDURL = "https://steamcdn-a.akamaihd.net/client/installer/steamcmd.zip"
 	windowsZipFileName = "steamcmd.zip"
-	linuxSteamCMDURL   = "http://media.steampowered.com/installer/steamcmd_linux.tar.gz"
 	linuxTarGzFileName = "steamcmd.tar.gz"
 	steamCMD           = "steamcmd"
-	arkGameID          = "346110"
+	instancesDirName   = ".steamcmd"
+	cacheDirName       = ".cache/mods"
 )
 
 // var ErrSteamCLINotAvailable = errors.New("steam cli not available")
 
+// ErrOffline is returned instead of running steamcmd in offline mode.
+var ErrOffline = errors.New("steamcmd is not available in offline mode")
+
 type SteamHandler struct {
 	CMDLocation string
-	workDir     string
+	// Offline serves mods only from the cache and never runs steamcmd.
+	Offline bool
+	// Login is the account steamcmd uses, nil logs in anonymously.
+	Login   *Login
+	workDir string
+	cache   *cache.Cache
+	cfg     *config.Config
 }
 
-func NewSteamHandler(workDir string) (*SteamHandler, error) {
+// NewSteamHandler creates the handler for the workdir, a nil cfg uses the
+// default settings.
+func NewSteamHandler(workDir string, cfg *config.Config) (*SteamHandler, error) {
+	if cfg == nil {
+		cfg = config.Default()
+	}
 	currPath, err := os.Getwd()
 	if err != nil {
 		return nil, err
 	}
-	if err := os.MkdirAll(filepath.Join(currPath, workDir), 0755); err != nil {
+	if !filepath.IsAbs(workDir) {
+		workDir = filepath.Join(currPath, workDir)
+	}
+	if err := os.MkdirAll(workDir, 0755); err != nil {
+		return nil, err
+	}
+	modCache, err := cache.New(filepath.Join(workDir, cacheDirName), cfg.CacheKeep)
+	if err != nil {
 		return nil, err
 	}
 	return &SteamHandler{
 		workDir: workDir,
+		cache:   modCache,
+		cfg:     cfg,
 	}, nil
 }
 
-func (s *SteamHandler) DownloadMod(modID string) (string, error) {
+// Cache holds the downloaded raw mods.
+func (s *SteamHandler) Cache() *cache.Cache {
+	return s.cache
+}
+
+// DownloadMod downloads the mod and returns the location of the raw mod in the cache.
+func (s *SteamHandler) DownloadMod(ctx context.Context, modID string) (string, error) {
 	if err := s.setSteamCMDPath(); err != nil {
 		return "", err
 	}
-	tmpDir := filepath.Join(os.TempDir(), "amm")
-	c := exec.Command(s.CMDLocation, "+login", "anonymous", "+force_install_dir", tmpDir, "+workshop_download_item", arkGameID, modID, "+quit")
-	c.Stderr = os.Stderr
-	c.Stdout = os.Stdout
-	if err := c.Run(); err != nil {
-		return "", err
-	}
-	defer func() {
-		if err := os.RemoveAll(tmpDir); err != nil {
-			fmt.Printf("could not cleanup tmp directory %v\n", err)
-		}
-
-	}()
-	if err := os.MkdirAll(s.workDir, 0755); err != nil {
+	inst, err := s.acquireInstance()
+	if err != nil {
 		return "", err
 	}
-	finalModLocation, err := s.copyMod(tmpDir, modID)
+	defer inst.close()
+	entry, err := s.downloadMod(ctx, inst, modID, HostPlatform())
 	if err != nil {
 		return "", err
 	}
-	return finalModLocation, nil
+	return entry.Path(), nil
 }
 
-func (s *SteamHandler) copyMod(srcLocation, modID string) (string, error) {
-	srcModLocation := filepath.Join(srcLocation, "/steamapps/workshop/content", arkGameID, modID)
-	dstLocation := filepath.Join(s.workDir, modID)
-	_, err := os.Stat(dstLocation)
-	if os.IsExist(err) {
-		return "", errors.New("destination mod location already exists")
+// downloadMod lets steamcmd update the content of the mod for the platform in
+// the instance and adds the downloaded version to the cache. The download
+// fails when steamcmd did not record the version it downloaded, the cache
+// would keep the content under a version it cannot look up.
+func (s *SteamHandler) downloadMod(ctx context.Context, inst *instance, modID, platform string) (*cache.Entry, error) {
+	installDir := inst.installDir(platform)
+	err := s.runLoggedIn(ctx, inst, platformArgs(platform), "+force_install_dir", installDir,
+		"+workshop_download_item", s.cfg.GameID, modID, "+quit")
+	if err != nil {
+		return nil, err
 	}
-	if err := copy.Copy(srcModLocation, dstLocation); err != nil {
-		return "", err
+	item, err := inst.installedItem(modID, platform)
+	if err != nil {
+		return nil, fmt.Errorf("reading workshop state of mod %s: %w", modID, err)
 	}
-	return dstLocation, nil
+	return s.cache.Add(modID, filepath.Join(installDir, s.cfg.WorkshopContentDir, s.cfg.GameID, modID), item.Manifest, platform, item.TimeUpdated)
 }
 
 func (s *SteamHandler) setSteamCMDPath() error {
+	if s.Offline {
+		return ErrOffline
+	}
 	absolutePath, err := exec.LookPath(steamCMD)
 	if err != nil {
 		return err
@@ -95,41 +123,67 @@ func (s *SteamHandler) setSteamCMDPath() error {
 	return nil
 }
 
-func (s *SteamHandler) DownloadCMD() error {
+// DownloadCMD fetches the steamcmd archive for the current platform, verifies
+// its checksum and unpacks it into the steam directory.
+func (s *SteamHandler) DownloadCMD(ctx context.Context, opts CMDDownloadOptions) error {
+	if s.Offline {
+		return ErrOffline
+	}
+	var archiveURL, fileName string
+	var unpack func(string) error
 	switch runtime.GOOS {
 	case "windows":
-		resp, err := http.Get(windowsSteamCMDURL)
-		if err != nil {
-			return err
-		}
-		data, err := ioutil.ReadAll(resp.Body)
-		if err != nil {
-			return err
-		}
-		defer resp.Body.Close()
-		if err := ioutil.WriteFile(filepath.Join(tmpSteamLocation, windowsZipFileName), data, 0755); err != nil {
-			return err
-		}
-		return s.unpackWindows(filepath.Join(tmpSteamLocation, windowsZipFileName))
+		archiveURL, fileName, unpack = s.cfg.SteamCMDURLWindows, windowsZipFileName, s.unpackWindows
 	case "linux":
-		resp, err := http.Get(linuxSteamCMDURL)
-		if err != nil {
-			return err
-		}
-		data, err := ioutil.ReadAll(resp.Body)
-		if err != nil {
-			return err
-		}
-		defer resp.Body.Close()
-		if err := ioutil.WriteFile(filepath.Join(tmpSteamLocation, linuxTarGzFileName), data, 0755); err != nil {
-			return err
-		}
-		return s.unpackLinux(filepath.Join(tmpSteamLocation, linuxTarGzFileName))
+		archiveURL, fileName, unpack = s.cfg.SteamCMDURLLinux, linuxTarGzFileName, s.unpackLinux
 	default:
 		fmt.Println("not supported")
+		return nil
+	}
+	if opts.URL != "" {
+		archiveURL = opts.URL
+	}
+	data, err := s.fetchCMDArchive(ctx, archiveURL, opts)
+	if err != nil {
+		return err
 	}
+	if err := opts.verify(data, path.Base(archiveURL)); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.cfg.SteamDir, 0755); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(s.cfg.SteamDir, fileName), data, 0644); err != nil {
+		return err
+	}
+	return unpack(filepath.Join(s.cfg.SteamDir, fileName))
+}
 
-	return nil
+func (s *SteamHandler) fetchCMDArchive(ctx context.Context, archiveURL string, opts CMDDownloadOptions) ([]byte, error) {
+	u, err := url.Parse(archiveURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported steamcmd url scheme %q", u.Scheme)
+	}
+	client, err := opts.httpClient()
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, archiveURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("could not download steamcmd from %s: %s", archiveURL, resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
 }
 
 func (s *SteamHandler) unpackWindows(zipLocation string) error {
@@ -144,12 +198,12 @@ func (s *SteamHandler) unpackWindows(zipLocation string) error {
 		}
 		defer rc.Close()
 		if f.FileInfo().IsDir() {
-			if err := os.MkdirAll(filepath.Join(tmpSteamLocation, f.Name), f.Mode()); err != nil {
+			if err := os.MkdirAll(filepath.Join(s.cfg.SteamDir, f.Name), f.Mode()); err != nil {
 				return err
 			}
 		} else {
 			outputFile, err := os.OpenFile(
-				filepath.Join(tmpSteamLocation, f.Name),
+				filepath.Join(s.cfg.SteamDir, f.Name),
 				os.O_WRONLY|os.O_CREATE|os.O_TRUNC,
 				f.Mode(),
 			)
@@ -187,7 +241,7 @@ func (s *SteamHandler) unpackLinux(tarGzLocation string) error {
 			return err
 		}
 
-		p := filepath.Join(tmpSteamLocation, header.Name)
+		p := filepath.Join(s.cfg.SteamDir, header.Name)
 		info := header.FileInfo()
 		if info.IsDir() {
 			if err = os.MkdirAll(p, info.Mode()); err != nil {
@@ -0,0 +1,120 @@
+package steam
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+var (
+	ErrUnverifiedPayload = errors.New("steamcmd archive has no configured checksum, refusing to unpack it")
+	ErrChecksumMismatch  = errors.New("steamcmd archive checksum does not match")
+)
+
+// CMDDownloadOptions controls where DownloadCMD fetches steamcmd from and how
+// the fetched archive is verified before it gets unpacked.
+type CMDDownloadOptions struct {
+	// URL overrides the default steamcmd archive location, e.g. an internal HTTPS mirror.
+	URL string
+	// SHA256 is the expected hex encoded checksum of the archive.
+	SHA256 string
+	// PinFile points to a file with pinned checksums in sha256sum format ("<hash>  <archive name>").
+	PinFile string
+	// Proxy is the HTTP proxy used for the download. Empty means the environment settings are used.
+	Proxy string
+	// AllowUnverified unpacks the archive even if no checksum is configured for it.
+	AllowUnverified bool
+}
+
+func (o CMDDownloadOptions) httpClient() (*http.Client, error) {
+	proxy := http.ProxyFromEnvironment
+	if o.Proxy != "" {
+		proxyURL, err := url.Parse(o.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy %q: %v", o.Proxy, err)
+		}
+		proxy = http.ProxyURL(proxyURL)
+	}
+	return &http.Client{
+		Timeout:   10 * time.Minute,
+		Transport: &http.Transport{Proxy: proxy},
+	}, nil
+}
+
+// expectedChecksums returns all checksums accepted for the given archive name.
+func (o CMDDownloadOptions) expectedChecksums(archiveName string) ([]string, error) {
+	var sums []string
+	if o.SHA256 != "" {
+		sums = append(sums, strings.ToLower(o.SHA256))
+	}
+	if o.PinFile != "" {
+		pinned, err := readPinFile(o.PinFile)
+		if err != nil {
+			return nil, err
+		}
+		sums = append(sums, pinned[archiveName]...)
+	}
+	return sums, nil
+}
+
+// verify checks data against the configured checksums of archiveName.
+func (o CMDDownloadOptions) verify(data []byte, archiveName string) error {
+	expected, err := o.expectedChecksums(archiveName)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(data)
+	actual := hex.EncodeToString(sum[:])
+	if len(expected) == 0 {
+		if o.AllowUnverified {
+			fmt.Printf("warning: %s is not verified, sha256: %s\n", archiveName, actual)
+			return nil
+		}
+		return ErrUnverifiedPayload
+	}
+	for _, e := range expected {
+		if e == actual {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s has sha256 %s", ErrChecksumMismatch, archiveName, actual)
+}
+
+// readPinFile parses a sha256sum style file. Several checksums can be pinned
+// for one archive name so mirrors can be rotated without downtime.
+func readPinFile(location string) (map[string][]string, error) {
+	f, err := os.Open(location)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	pinned := map[string][]string{}
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: expected \"<sha256> <archive name>\"", location, line)
+		}
+		sum := strings.ToLower(fields[0])
+		if _, err := hex.DecodeString(sum); err != nil || len(sum) != sha256.Size*2 {
+			return nil, fmt.Errorf("%s:%d: invalid sha256 %q", location, line, fields[0])
+		}
+		name := strings.TrimPrefix(fields[1], "*")
+		pinned[name] = append(pinned[name], sum)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return pinned, nil
+}
@@ -0,0 +1,51 @@
+package steam
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCMDDownloadOptions_verify(t *testing.T) {
+	data := []byte("steamcmd")
+	sum := sha256.Sum256(data)
+	good := hex.EncodeToString(sum[:])
+	bad := hex.EncodeToString(make([]byte, sha256.Size))
+
+	pinFile := filepath.Join(t.TempDir(), "pins")
+	pins := "# rotated on mirror update\n" + bad + "  steamcmd_linux.tar.gz\n" + good + " *steamcmd_linux.tar.gz\n"
+	if err := ioutil.WriteFile(pinFile, []byte(pins), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		opts    CMDDownloadOptions
+		archive string
+		wantErr error
+	}{
+		{name: "flag checksum", opts: CMDDownloadOptions{SHA256: good}, archive: "steamcmd.zip"},
+		{name: "flag checksum upper case", opts: CMDDownloadOptions{SHA256: strings.ToUpper(good)}, archive: "steamcmd.zip"},
+		{name: "flag mismatch", opts: CMDDownloadOptions{SHA256: bad}, archive: "steamcmd.zip", wantErr: ErrChecksumMismatch},
+		{name: "pinned", opts: CMDDownloadOptions{PinFile: pinFile}, archive: "steamcmd_linux.tar.gz"},
+		{name: "not pinned", opts: CMDDownloadOptions{PinFile: pinFile}, archive: "steamcmd.zip", wantErr: ErrUnverifiedPayload},
+		{name: "unverified", opts: CMDDownloadOptions{}, archive: "steamcmd.zip", wantErr: ErrUnverifiedPayload},
+		{name: "unverified allowed", opts: CMDDownloadOptions{AllowUnverified: true}, archive: "steamcmd.zip"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.opts.verify(data, tt.archive)
+			if tt.wantErr == nil {
+				assert.NoError(t, err)
+				return
+			}
+			assert.True(t, errors.Is(err, tt.wantErr), "got %v", err)
+		})
+	}
+}
@@ -0,0 +1,200 @@
+package unpacker
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Kinds of file changes between two versions of a mod.
+const (
+	FileAdded   = "added"
+	FileRemoved = "removed"
+	FileChanged = "changed"
+)
+
+// FileChange is a file which differs between two versions of a mod.
+type FileChange struct {
+	// Path is relative to the mod content, without the .z of raw archives.
+	Path    string
+	Kind    string
+	OldSize int64
+	NewSize int64
+}
+
+// Delta returns how much the file grew, negative when it shrank.
+func (c FileChange) Delta() int64 {
+	return c.NewSize - c.OldSize
+}
+
+// treeFile is a file of a mod version, raw files are .z archives.
+type treeFile struct {
+	path string
+	size int64
+	raw  bool
+	// packedSize and unpackedSize are read from the header of raw files
+	packedSize   int64
+	unpackedSize int64
+}
+
+// Diff compares two versions of a mod. Each can be an unpacked content
+// folder or a raw download with .z archives, raw downloads are compared in
+// the folder of the given platform. Files are only hashed when their sizes
+// match, raw archives are only decompressed when compared to an unpacked file.
+func Diff(from, to, platform string) ([]FileChange, error) {
+	oldFiles, err := listTree(from, platform)
+	if err != nil {
+		return nil, err
+	}
+	newFiles, err := listTree(to, platform)
+	if err != nil {
+		return nil, err
+	}
+	var changes []FileChange
+	for relPath, old := range oldFiles {
+		f, ok := newFiles[relPath]
+		if !ok {
+			changes = append(changes, FileChange{Path: relPath, Kind: FileRemoved, OldSize: old.size})
+			continue
+		}
+		same, err := sameContent(old, f)
+		if err != nil {
+			return nil, err
+		}
+		if !same {
+			changes = append(changes, FileChange{Path: relPath, Kind: FileChanged, OldSize: old.size, NewSize: f.size})
+		}
+	}
+	for relPath, f := range newFiles {
+		if _, ok := oldFiles[relPath]; !ok {
+			changes = append(changes, FileChange{Path: relPath, Kind: FileAdded, NewSize: f.size})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes, nil
+}
+
+// contentRoot returns the platform folder of a raw download or unpacked
+// download, an installed content folder is returned as it is.
+func contentRoot(dir, platform string) string {
+	m := &ModUnpacker{Platform: platform, rawModsDirName: dir}
+	if platformDir, err := m.platformDir(); err == nil {
+		return platformDir
+	}
+	return dir
+}
+
+// listTree returns the files of a mod version by their path relative to its
+// content root. The size of raw archives is their uncompressed size.
+func listTree(dir, platform string) (map[string]*treeFile, error) {
+	stat, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !stat.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", dir)
+	}
+	root := contentRoot(dir, platform)
+	files := map[string]*treeFile{}
+	err = filepath.Walk(root, func(path string, f os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if f.IsDir() || strings.HasSuffix(f.Name(), ".z.uncompressed_size") {
+			return nil
+		}
+		relPath, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		file := &treeFile{path: path, size: f.Size()}
+		if strings.HasSuffix(f.Name(), ".z") {
+			relPath = strings.TrimSuffix(relPath, ".z")
+			if err := readRawSizes(file); err != nil {
+				return err
+			}
+		}
+		files[filepath.ToSlash(relPath)] = file
+		return nil
+	})
+	return files, err
+}
+
+// readRawSizes reads the sizes of a raw archive from its header and its
+// .uncompressed_size file, without decompressing it.
+func readRawSizes(file *treeFile) error {
+	file.raw = true
+	f, err := os.Open(file.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	header, err := (&ModUnpacker{}).unpackArchiveHeader(f)
+	if err != nil {
+		return err
+	}
+	file.packedSize = header.packedSize
+	file.unpackedSize = header.unpackedSize
+	file.size = header.unpackedSize
+	if data, err := ioutil.ReadFile(file.path + ".uncompressed_size"); err == nil {
+		if size, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64); err == nil {
+			file.size = size
+		}
+	}
+	return nil
+}
+
+func sameContent(a, b *treeFile) (bool, error) {
+	if a.size != b.size {
+		return false, nil
+	}
+	if a.raw && b.raw && (a.packedSize != b.packedSize || a.unpackedSize != b.unpackedSize) {
+		return false, nil
+	}
+	if statA, err := os.Stat(a.path); err == nil {
+		if statB, err := os.Stat(b.path); err == nil && os.SameFile(statA, statB) {
+			return true, nil
+		}
+	}
+	// two archives with the same content are compared without decompressing them
+	raw := a.raw && b.raw
+	hashA, err := hashFile(a, raw)
+	if err != nil {
+		return false, err
+	}
+	hashB, err := hashFile(b, raw)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(hashA, hashB), nil
+}
+
+// hashFile hashes the file as it is stored with asStored, otherwise raw
+// archives are decompressed first.
+func hashFile(file *treeFile, asStored bool) ([]byte, error) {
+	f, err := os.Open(file.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if file.raw && !asStored {
+		data, err := (&ModUnpacker{}).unpackArchive(f)
+		if err != nil {
+			return nil, err
+		}
+		h.Write(data)
+		return h.Sum(nil), nil
+	}
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
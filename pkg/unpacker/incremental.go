@@ -0,0 +1,141 @@
+package unpacker
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const indexDirName = ".amm-index"
+
+// archiveIndex records the archives a mod was unpacked from, so the next
+// incremental unpack knows which of them changed.
+type archiveIndex struct {
+	// Archives maps the RelPath of an archive to its size and hash.
+	Archives map[string]indexEntry `json:"archives"`
+}
+
+type indexEntry struct {
+	Size int64  `json:"size"`
+	Hash string `json:"hash"`
+}
+
+// indexPath returns where the archive index of the mod is kept in the unpack directory.
+func (m *ModUnpacker) indexPath() string {
+	return filepath.Join(m.unpackedWorkDirName, indexDirName, strconv.FormatInt(m.modID, 10)+".json")
+}
+
+// outputPath returns the location an archive is unpacked to.
+func (m *ModUnpacker) outputPath(relPath string) string {
+	return filepath.Join(m.unpackedWorkDirName, strings.TrimSuffix(relPath, ".z"))
+}
+
+func (m *ModUnpacker) readIndex() (*archiveIndex, error) {
+	index := &archiveIndex{Archives: map[string]indexEntry{}}
+	data, err := ioutil.ReadFile(m.indexPath())
+	if os.IsNotExist(err) {
+		return index, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, index); err != nil {
+		// a broken index only costs a full unpack
+		return &archiveIndex{Archives: map[string]indexEntry{}}, nil
+	}
+	if index.Archives == nil {
+		index.Archives = map[string]indexEntry{}
+	}
+	return index, nil
+}
+
+func (m *ModUnpacker) writeIndex(index *archiveIndex) error {
+	data, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+	location := m.indexPath()
+	if err := m.ensureDir(location); err != nil {
+		return err
+	}
+	tmp := location + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, location)
+}
+
+// removeIndex drops the index, an unpack which does not maintain it would
+// otherwise leave it describing an older version.
+func (m *ModUnpacker) removeIndex() error {
+	if err := os.Remove(m.indexPath()); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// changedArchives returns the index of the archives and those of them which
+// differ from the old index or whose unpacked file is missing.
+func (m *ModUnpacker) changedArchives(archives []*archiveFile, old *archiveIndex) (*archiveIndex, []*archiveFile, error) {
+	index := &archiveIndex{Archives: map[string]indexEntry{}}
+	var changed []*archiveFile
+	for _, a := range archives {
+		h, err := hashFileAt(a.AbsPath)
+		if err != nil {
+			return nil, nil, err
+		}
+		entry := indexEntry{Size: h.Size, Hash: h.SHA256}
+		index.Archives[a.RelPath] = entry
+		if prev, ok := old.Archives[a.RelPath]; ok && prev == entry {
+			if _, err := os.Stat(m.outputPath(a.RelPath)); err == nil {
+				continue
+			}
+		}
+		changed = append(changed, a)
+	}
+	return index, changed, nil
+}
+
+// removeStale deletes the files unpacked from archives which are in the old
+// index but not in the new one, and the folders left empty by that.
+func (m *ModUnpacker) removeStale(old, index *archiveIndex) (int, error) {
+	removed := 0
+	for relPath := range old.Archives {
+		if _, ok := index.Archives[relPath]; ok {
+			continue
+		}
+		location := m.outputPath(relPath)
+		if err := os.Remove(location); err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return removed, err
+		}
+		removed++
+		for dir := filepath.Dir(location); strings.HasPrefix(dir, m.unpackedWorkDirName+string(filepath.Separator)); dir = filepath.Dir(dir) {
+			// fails on the first folder which is not empty
+			if os.Remove(dir) != nil {
+				break
+			}
+		}
+	}
+	return removed, nil
+}
+
+// reusableHashes returns the manifest hashes of the files which were not
+// unpacked again, keyed like the manifest.
+func (m *ModUnpacker) reusableHashes(unpacked []*archiveFile) map[string]FileHash {
+	id := strconv.FormatInt(m.modID, 10)
+	manifest, err := ReadManifest(m.unpackedWorkDirName, id)
+	if err != nil {
+		return nil
+	}
+	for _, a := range unpacked {
+		relPath := filepath.ToSlash(strings.TrimSuffix(a.RelPath, ".z"))
+		delete(manifest.Files, strings.TrimPrefix(relPath, id+"/"))
+	}
+	return manifest.Files
+}
@@ -0,0 +1,166 @@
+package unpacker
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/d8x/amm/pkg/journal"
+	"github.com/otiai10/copy"
+)
+
+const (
+	modInfoFile     = "mod.info"
+	modMetaInfoFile = "modmeta.info"
+)
+
+var platformDirNames = map[string]string{
+	"windows": "WindowsNoEditor",
+	"linux":   "LinuxNoEditor",
+}
+
+// Install unpacks the mod the way the ARK server loads it: the content of the
+// platform folder goes to <modsDir>/<id> and the generated mod file to
+// <modsDir>/<id>.mod. Everything is unpacked next to the Mods folder content
+// first, the previous version is only replaced once that succeeded, by
+// journaled renames which Recover completes after a crash. A manifest of the
+// installed files is written for Verify.
+func (m *ModUnpacker) Install(ctx context.Context, modsDir string) error {
+	platformDir, err := m.platformDir()
+	if err != nil {
+		return err
+	}
+	archives, plainFiles, err := m.listPlatformFiles(platformDir)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(modsDir, 0755); err != nil {
+		return err
+	}
+	if _, err := Recover(modsDir); err != nil {
+		return err
+	}
+	size, err := m.InstallSize()
+	if err != nil {
+		return err
+	}
+	if err := m.checkSpace(modsDir, size); err != nil {
+		return err
+	}
+	id := strconv.FormatInt(m.modID, 10)
+	stagingDir, err := ioutil.TempDir(modsDir, ".staging-"+id+"-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(stagingDir)
+	contentDir := filepath.Join(stagingDir, id)
+	if err := m.unpackArchives(ctx, archives, contentDir); err != nil {
+		return err
+	}
+	for _, relPath := range plainFiles {
+		if err := copy.Copy(filepath.Join(platformDir, relPath), filepath.Join(contentDir, relPath)); err != nil {
+			return err
+		}
+	}
+	modFile := filepath.Join(stagingDir, id+".mod")
+	if err := m.writeModFile(platformDir, modFile); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := journal.Swap(modsDir, id, stagingDir); err != nil {
+		return err
+	}
+	return WriteManifest(modsDir, id)
+}
+
+// Recover completes the installs and removals in modsDir which were
+// interrupted, see journal.Recover, and returns the ids of their mods.
+func Recover(modsDir string) ([]string, error) {
+	recovered, err := journal.Recover(modsDir)
+	for _, id := range recovered {
+		if _, statErr := os.Stat(filepath.Join(modsDir, id)); os.IsNotExist(statErr) {
+			if err := RemoveManifest(modsDir, id); err != nil {
+				return recovered, err
+			}
+			continue
+		}
+		if err := WriteManifest(modsDir, id); err != nil {
+			return recovered, err
+		}
+	}
+	return recovered, err
+}
+
+// platformDir returns the folder with the content of the mod for the server.
+// The folder of the other platform is used when the mod has no content for
+// the server platform.
+func (m *ModUnpacker) platformDir() (string, error) {
+	names := []string{platformDirNames["windows"], platformDirNames["linux"]}
+	if name, ok := platformDirNames[m.Platform]; ok {
+		names = append([]string{name}, names...)
+	}
+	for _, name := range names {
+		dir := filepath.Join(m.rawModsDirName, name)
+		if stat, err := os.Stat(dir); err == nil && stat.IsDir() {
+			return dir, nil
+		}
+	}
+	return "", errors.New("mod has no platform folder")
+}
+
+// listPlatformFiles returns the archives and the files which are installed
+// as they are, relative to platformDir.
+func (m *ModUnpacker) listPlatformFiles(platformDir string) ([]*archiveFile, []string, error) {
+	archives, err := m.listArchives(platformDir, platformDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	var plainFiles []string
+	err = filepath.Walk(platformDir, func(path string, f os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if f.IsDir() || strings.HasSuffix(f.Name(), ".z") || strings.HasSuffix(f.Name(), ".z.uncompressed_size") {
+			return nil
+		}
+		relPath, err := filepath.Rel(platformDir, path)
+		if err != nil {
+			return err
+		}
+		plainFiles = append(plainFiles, relPath)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return archives, plainFiles, nil
+}
+
+// writeModFile creates the .mod file from mod.info and, if the mod has one,
+// modmeta.info.
+func (m *ModUnpacker) writeModFile(platformDir, location string) error {
+	modInfoReader, err := m.getFileReader(filepath.Join(platformDir, modInfoFile))
+	if err != nil {
+		return err
+	}
+	modInfo, err := m.unpackModInfo(modInfoReader)
+	if err != nil {
+		return err
+	}
+	var modMetaInfo []modMetaInfo
+	modMetaInfoReader, err := m.getFileReader(filepath.Join(platformDir, modMetaInfoFile))
+	if err == nil {
+		if modMetaInfo, err = m.unpackModMetaInfo(modMetaInfoReader); err != nil {
+			return err
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	return m.writeFile(m.createModFileData(modInfo, modMetaInfo), location)
+}
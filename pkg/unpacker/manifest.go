@@ -0,0 +1,238 @@
+package unpacker
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const manifestDirName = ".amm-manifest"
+
+// Kinds of problems Verify finds.
+const (
+	FileMissing  = "missing"
+	FileExtra    = "extra"
+	FileModified = "modified"
+)
+
+var ErrNoManifest = errors.New("mod has no manifest")
+
+// Manifest records what an unpacked or installed mod contains.
+type Manifest struct {
+	ModID string `json:"mod_id"`
+	// Files are keyed by their slash separated path in the mod folder.
+	Files map[string]FileHash `json:"files"`
+	// ModFile is the <id>.mod file next to the mod folder, nil when there is none.
+	ModFile *FileHash `json:"mod_file,omitempty"`
+}
+
+type FileHash struct {
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Problem is a file of a mod which does not match its manifest.
+type Problem struct {
+	Path string
+	Kind string
+}
+
+func manifestPath(root, modID string) string {
+	return filepath.Join(root, manifestDirName, modID+".json")
+}
+
+// WriteManifest hashes the mod folder and .mod file of the mod in root and
+// records them in its manifest.
+func WriteManifest(root, modID string) error {
+	return writeManifest(root, modID, nil)
+}
+
+// writeManifest takes the hashes of files in reuse instead of reading them
+// again, as long as their size did not change.
+func writeManifest(root, modID string, reuse map[string]FileHash) error {
+	manifest := &Manifest{ModID: modID, Files: map[string]FileHash{}}
+	modDir := filepath.Join(root, modID)
+	err := filepath.Walk(modDir, func(path string, f os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if f.IsDir() {
+			return nil
+		}
+		relPath, err := filepath.Rel(modDir, path)
+		if err != nil {
+			return err
+		}
+		relPath = filepath.ToSlash(relPath)
+		if h, ok := reuse[relPath]; ok && h.Size == f.Size() {
+			manifest.Files[relPath] = h
+			return nil
+		}
+		h, err := hashFileAt(path)
+		if err != nil {
+			return err
+		}
+		manifest.Files[relPath] = h
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if h, err := hashFileAt(filepath.Join(root, modID+".mod")); err == nil {
+		manifest.ModFile = &h
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	location := manifestPath(root, modID)
+	if err := os.MkdirAll(filepath.Dir(location), 0755); err != nil {
+		return err
+	}
+	tmp := location + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, location)
+}
+
+// ReadManifest returns the manifest of the mod in root.
+func ReadManifest(root, modID string) (*Manifest, error) {
+	data, err := ioutil.ReadFile(manifestPath(root, modID))
+	if os.IsNotExist(err) {
+		return nil, ErrNoManifest
+	}
+	if err != nil {
+		return nil, err
+	}
+	manifest := &Manifest{}
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// RemoveManifest deletes the manifest of the mod in root.
+func RemoveManifest(root, modID string) error {
+	if err := os.Remove(manifestPath(root, modID)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// ManifestIDs returns the ids of the mods in root which have a manifest.
+func ManifestIDs(root string) ([]string, error) {
+	entries, err := ioutil.ReadDir(filepath.Join(root, manifestDirName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), ".json") {
+			ids = append(ids, strings.TrimSuffix(e.Name(), ".json"))
+		}
+	}
+	return ids, nil
+}
+
+// Verify compares the mod in root with its manifest. Files are only hashed
+// when their size matches.
+func Verify(root, modID string) ([]Problem, error) {
+	manifest, err := ReadManifest(root, modID)
+	if err != nil {
+		return nil, err
+	}
+	var problems []Problem
+	modDir := filepath.Join(root, modID)
+	seen := map[string]bool{}
+	err = filepath.Walk(modDir, func(path string, f os.FileInfo, err error) error {
+		if os.IsNotExist(err) && path == modDir {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if f.IsDir() {
+			return nil
+		}
+		relPath, err := filepath.Rel(modDir, path)
+		if err != nil {
+			return err
+		}
+		relPath = filepath.ToSlash(relPath)
+		expected, ok := manifest.Files[relPath]
+		if !ok {
+			problems = append(problems, Problem{Path: relPath, Kind: FileExtra})
+			return nil
+		}
+		seen[relPath] = true
+		matches, err := matchesHash(path, f.Size(), expected)
+		if err != nil {
+			return err
+		}
+		if !matches {
+			problems = append(problems, Problem{Path: relPath, Kind: FileModified})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for relPath := range manifest.Files {
+		if !seen[relPath] {
+			problems = append(problems, Problem{Path: relPath, Kind: FileMissing})
+		}
+	}
+	if manifest.ModFile != nil {
+		modFile := filepath.Join(root, modID+".mod")
+		stat, err := os.Stat(modFile)
+		if os.IsNotExist(err) {
+			problems = append(problems, Problem{Path: modID + ".mod", Kind: FileMissing})
+		} else if err != nil {
+			return nil, err
+		} else if matches, err := matchesHash(modFile, stat.Size(), *manifest.ModFile); err != nil {
+			return nil, err
+		} else if !matches {
+			problems = append(problems, Problem{Path: modID + ".mod", Kind: FileModified})
+		}
+	}
+	sort.Slice(problems, func(i, j int) bool { return problems[i].Path < problems[j].Path })
+	return problems, nil
+}
+
+func matchesHash(location string, size int64, expected FileHash) (bool, error) {
+	if size != expected.Size {
+		return false, nil
+	}
+	h, err := hashFileAt(location)
+	if err != nil {
+		return false, err
+	}
+	return h.SHA256 == expected.SHA256, nil
+}
+
+func hashFileAt(location string) (FileHash, error) {
+	f, err := os.Open(location)
+	if err != nil {
+		return FileHash{}, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return FileHash{}, err
+	}
+	return FileHash{Size: size, SHA256: hex.EncodeToString(h.Sum(nil))}, nil
+}
@@ -0,0 +1,179 @@
+package unpacker
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"unicode/utf16"
+)
+
+// ModFile is the content of a <id>.mod file next to the mod content in the
+// server Mods folder.
+type ModFile struct {
+	ID      int64
+	Name    string
+	Path    string
+	Maps    []string
+	ModType byte
+	Meta    map[string]string
+}
+
+// maxModFileString limits strings read from .mod files, a larger size means
+// the file is broken.
+const maxModFileString = 1 << 16
+
+// ReadModFile parses the .mod file at location, written by ARK or by Install.
+func ReadModFile(location string) (*ModFile, error) {
+	f, err := os.Open(location)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	m, err := parseModFile(bufio.NewReader(f))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", location, err)
+	}
+	return m, nil
+}
+
+func parseModFile(r io.Reader) (*ModFile, error) {
+	m := &ModFile{Meta: map[string]string{}}
+	var id uint64
+	if err := binary.Read(r, binary.LittleEndian, &id); err != nil {
+		return nil, err
+	}
+	m.ID = int64(id)
+	var err error
+	if m.Name, err = readModFileString(r); err != nil {
+		return nil, err
+	}
+	if m.Path, err = readModFileString(r); err != nil {
+		return nil, err
+	}
+	var maps uint32
+	if err := binary.Read(r, binary.LittleEndian, &maps); err != nil {
+		return nil, err
+	}
+	for i := uint32(0); i < maps; i++ {
+		name, err := readModFileString(r)
+		if err != nil {
+			return nil, err
+		}
+		m.Maps = append(m.Maps, name)
+	}
+	var magic uint32
+	var version int32
+	if err := binary.Read(r, binary.LittleEndian, &magic); err != nil {
+		return nil, err
+	}
+	if err := binary.Read(r, binary.LittleEndian, &version); err != nil {
+		return nil, err
+	}
+	if err := binary.Read(r, binary.LittleEndian, &m.ModType); err != nil {
+		return nil, err
+	}
+	var unknown, pairs int32
+	if err := binary.Read(r, binary.LittleEndian, &unknown); err != nil {
+		return nil, err
+	}
+	if err := binary.Read(r, binary.LittleEndian, &pairs); err != nil {
+		// files without meta data end here
+		if errors.Is(err, io.EOF) {
+			return m, nil
+		}
+		return nil, err
+	}
+	for i := int32(0); i < pairs; i++ {
+		key, err := readModFileString(r)
+		if err != nil {
+			return nil, err
+		}
+		value, err := readModFileString(r)
+		if err != nil {
+			return nil, err
+		}
+		m.Meta[key] = value
+	}
+	return m, nil
+}
+
+// readModFileString reads an UE4 FString, a negative size marks UTF-16 text.
+func readModFileString(r io.Reader) (string, error) {
+	var size int32
+	if err := binary.Read(r, binary.LittleEndian, &size); err != nil {
+		return "", err
+	}
+	switch {
+	case size == 0:
+		return "", nil
+	case size > maxModFileString || size < -maxModFileString:
+		return "", fmt.Errorf("invalid string size %d", size)
+	case size < 0:
+		d := make([]uint16, -size)
+		if err := binary.Read(r, binary.LittleEndian, d); err != nil {
+			return "", err
+		}
+		return string(utf16.Decode(d[:len(d)-1])), nil
+	}
+	d := make([]byte, size)
+	if _, err := io.ReadFull(r, d); err != nil {
+		return "", err
+	}
+	return string(d[:len(d)-1]), nil
+}
+
+// createModFileData builds the .mod file ARK expects next to the content
+// folder. All numbers are little endian, strings are UE4 FStrings:
+//
+//	uint64   mod id
+//	FString  "ModName"
+//	FString  "" (mod path)
+//	uint32   number of maps, followed by the map FStrings of mod.info
+//	uint32   4280483635 (0xFF22FF33) magic
+//	int32    2 version
+//	byte     mod type, 1 when modmeta.info has a ModType
+//	int32    2
+//	int32    number of meta pairs, followed by key and value FStrings
+func (m *ModUnpacker) createModFileData(mInfo []ue4String, mMInfo []modMetaInfo) []byte {
+	buff := bytes.Buffer{}
+
+	// modID as 8 bytes, ids below 2^32 are followed by 4 padding bytes
+	binary.Write(&buff, binary.LittleEndian, uint64(m.modID))
+
+	binary.Write(&buff, binary.LittleEndian, newUE4String("ModName").Bytes())
+
+	binary.Write(&buff, binary.LittleEndian, newUE4String("").Bytes())
+
+	binary.Write(&buff, binary.LittleEndian, uint32(len(mInfo)))
+
+	for _, v := range mInfo {
+		binary.Write(&buff, binary.LittleEndian, newUE4String(v.text).Bytes())
+	}
+	// some static needed data
+	binary.Write(&buff, binary.LittleEndian, uint32(4280483635))
+	// some static needed data again
+	binary.Write(&buff, binary.LittleEndian, int32(2))
+
+	modType := []byte{0}
+
+	for _, m := range mMInfo {
+		if m.key == "ModType" {
+			fmt.Printf("found ModType")
+			modType = []byte{1}
+		}
+	}
+	// can be tricky to be validated
+	binary.Write(&buff, binary.LittleEndian, modType)
+	binary.Write(&buff, binary.LittleEndian, int32(2))
+	binary.Write(&buff, binary.LittleEndian, int32(len(mMInfo)))
+	for _, d := range mMInfo {
+		binary.Write(&buff, binary.LittleEndian, newUE4String(d.key).Bytes())
+		binary.Write(&buff, binary.LittleEndian, newUE4String(d.value).Bytes())
+	}
+
+	return buff.Bytes()
+}
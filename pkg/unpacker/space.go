@@ -0,0 +1,69 @@
+package unpacker
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/d8x/amm/pkg/diskspace"
+)
+
+// UnpackSize returns the space Unpack needs, the uncompressed size of all
+// archives of the mod.
+func (m *ModUnpacker) UnpackSize() (int64, error) {
+	archives, err := m.getArchivedFilesPathsSizes(m.rawModsDirName)
+	if err != nil {
+		return 0, err
+	}
+	return archivesSize(archives)
+}
+
+// InstallSize returns the space Install needs, the uncompressed size of the
+// archives and the size of the other files in the platform folder. The
+// previous version is only removed once the new one is in place, so it does
+// not make room.
+func (m *ModUnpacker) InstallSize() (int64, error) {
+	platformDir, err := m.platformDir()
+	if err != nil {
+		return 0, err
+	}
+	archives, plainFiles, err := m.listPlatformFiles(platformDir)
+	if err != nil {
+		return 0, err
+	}
+	size, err := archivesSize(archives)
+	if err != nil {
+		return 0, err
+	}
+	for _, relPath := range plainFiles {
+		stat, err := os.Stat(filepath.Join(platformDir, relPath))
+		if err != nil {
+			return 0, err
+		}
+		size += stat.Size()
+	}
+	return size, nil
+}
+
+// archivesSize adds up the sizes from the .uncompressed_size files, the
+// header is read for archives without one.
+func archivesSize(archives []*archiveFile) (int64, error) {
+	var size int64
+	for _, a := range archives {
+		if a.Size > 0 {
+			size += int64(a.Size)
+			continue
+		}
+		f := &treeFile{path: a.AbsPath}
+		if err := readRawSizes(f); err != nil {
+			return 0, err
+		}
+		size += f.size
+	}
+	return size, nil
+}
+
+// checkSpace refuses to start writing size bytes into dir when less than
+// MinFree bytes would be left.
+func (m *ModUnpacker) checkSpace(dir string, size int64) error {
+	return diskspace.Check([]diskspace.Need{{Path: dir, Bytes: size}}, m.MinFree)
+}
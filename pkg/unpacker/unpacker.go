@@ -4,27 +4,46 @@ import (
 	"bufio"
 	"bytes"
 	"compress/zlib"
+	"context"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
-	"path"
 	"path/filepath"
 	"regexp"
+	"runtime"
 	"strconv"
 	"strings"
+	"sync"
+
+	"github.com/d8x/amm/pkg/config"
 )
 
 type ModUnpacker struct {
-	modID               int32
+	// Platform is the platform of the server Install unpacks for, "windows"
+	// or "linux". Its content folder is preferred.
+	Platform string
+	// Incremental makes Unpack skip the archives which did not change since
+	// the last incremental unpack into the same directory.
+	Incremental bool
+	// MinFree is the space Unpack and Install leave free on the filesystem
+	// they write to, they refuse to start otherwise.
+	MinFree             int64
+	modID               int64
 	currentPath         string
 	rawModsDirName      string
 	unpackedWorkDirName string
+	workers             int
 }
 
-func NewModsUnpacker(rawModPath, unpackModDirectory string) (*ModUnpacker, error) {
+// NewModsUnpacker creates the unpacker of the raw mod, a nil cfg uses the
+// default settings.
+func NewModsUnpacker(rawModPath, unpackModDirectory string, cfg *config.Config) (*ModUnpacker, error) {
+	if cfg == nil {
+		cfg = config.Default()
+	}
 	currPath, err := os.Getwd()
 	if err != nil {
 		return nil, err
@@ -32,47 +51,164 @@ func NewModsUnpacker(rawModPath, unpackModDirectory string) (*ModUnpacker, error
 	if !filepath.IsAbs(unpackModDirectory) {
 		unpackModDirectory = filepath.Join(currPath, unpackModDirectory)
 	}
-	modID, err := strconv.ParseInt(filepath.Base(rawModPath), 10, 32)
+	modID, err := strconv.ParseInt(filepath.Base(rawModPath), 10, 64)
 	if err != nil {
 		return nil, err
 	}
 	if err := os.MkdirAll(unpackModDirectory, 0755); err != nil {
 		return nil, err
 	}
+	workers := cfg.UnpackWorkers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
 	return &ModUnpacker{
-		modID:               int32(modID),
+		modID:               modID,
 		currentPath:         currPath,
 		rawModsDirName:      rawModPath,
 		unpackedWorkDirName: unpackModDirectory,
+		workers:             workers,
 	}, nil
 }
 
-func (m *ModUnpacker) Unpack() error {
+// Unpack decompresses all archives of the mod. The files are unpacked into a
+// staging directory first and only moved into the destination once every
+// archive succeeded, so a cancelled or failed unpack leaves it unchanged.
+// With Incremental only the archives changed since the last incremental
+// unpack are decompressed and the files of removed archives are deleted.
+// A manifest of the unpacked files is written for Verify.
+func (m *ModUnpacker) Unpack(ctx context.Context) error {
 	archivedFilesPathsSizes, err := m.getArchivedFilesPathsSizes(m.rawModsDirName)
 	if err != nil {
 		return err
 	}
-	for _, archiveFile := range archivedFilesPathsSizes {
-		fileReader, err := m.getFileReader(archiveFile.AbsPath)
-		if err != nil {
+	old, index := &archiveIndex{}, &archiveIndex{}
+	if m.Incremental {
+		if old, err = m.readIndex(); err != nil {
 			return err
 		}
-		unpackedData, err := m.unpackArchive(fileReader)
-		if err != nil {
-			fmt.Printf("could not unpack archive: %s\n", archiveFile.AbsPath)
+		total := len(archivedFilesPathsSizes)
+		if index, archivedFilesPathsSizes, err = m.changedArchives(archivedFilesPathsSizes, old); err != nil {
 			return err
 		}
-		if archiveFile.Size != len(unpackedData) {
-			fmt.Printf("size missmatch should: %d, is: %d\n", archiveFile.Size, len(unpackedData))
+		fmt.Printf("%d of %d archives changed\n", len(archivedFilesPathsSizes), total)
+	} else if err := m.removeIndex(); err != nil {
+		return err
+	}
+	size, err := archivesSize(archivedFilesPathsSizes)
+	if err != nil {
+		return err
+	}
+	if err := m.checkSpace(m.unpackedWorkDirName, size); err != nil {
+		return err
+	}
+	stagingDir, err := ioutil.TempDir(m.unpackedWorkDirName, ".staging-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(stagingDir)
+	if err := m.unpackArchives(ctx, archivedFilesPathsSizes, stagingDir); err != nil {
+		return err
+	}
+	if err := m.commitStaging(stagingDir); err != nil {
+		return err
+	}
+	id := strconv.FormatInt(m.modID, 10)
+	if !m.Incremental {
+		return WriteManifest(m.unpackedWorkDirName, id)
+	}
+	removed, err := m.removeStale(old, index)
+	if err != nil {
+		return err
+	}
+	if removed > 0 {
+		fmt.Printf("%d files of removed archives deleted\n", removed)
+	}
+	if err := writeManifest(m.unpackedWorkDirName, id, m.reusableHashes(archivedFilesPathsSizes)); err != nil {
+		return err
+	}
+	return m.writeIndex(index)
+}
+
+func (m *ModUnpacker) unpackArchives(ctx context.Context, archives []*archiveFile, outDir string) error {
+	workerCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	workers := m.workers
+	if workers < 1 {
+		workers = 1
+	}
+	jobs := make(chan *archiveFile)
+	// every worker sends at most one error before it stops
+	errs := make(chan error, workers)
+	wg := sync.WaitGroup{}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for archiveFile := range jobs {
+				if err := m.unpackArchiveFile(archiveFile, outDir); err != nil {
+					errs <- err
+					cancel()
+					return
+				}
+			}
+		}()
+	}
+feed:
+	for _, archiveFile := range archives {
+		select {
+		case jobs <- archiveFile:
+		case <-workerCtx.Done():
+			break feed
 		}
-		unpackFile := filepath.Join(m.unpackedWorkDirName, strings.TrimRight(archiveFile.RelPath, ".z"))
+	}
+	close(jobs)
+	wg.Wait()
+	close(errs)
+	if err := <-errs; err != nil {
+		return err
+	}
+	return ctx.Err()
+}
 
-		err = m.writeFile(unpackedData, unpackFile)
+func (m *ModUnpacker) unpackArchiveFile(archiveFile *archiveFile, outDir string) error {
+	fileReader, err := m.getFileReader(archiveFile.AbsPath)
+	if err != nil {
+		return err
+	}
+	unpackedData, err := m.unpackArchive(fileReader)
+	if err != nil {
+		fmt.Printf("could not unpack archive: %s\n", archiveFile.AbsPath)
+		return err
+	}
+	if archiveFile.Size != len(unpackedData) {
+		fmt.Printf("size missmatch should: %d, is: %d\n", archiveFile.Size, len(unpackedData))
+	}
+	unpackFile := filepath.Join(outDir, strings.TrimSuffix(archiveFile.RelPath, ".z"))
+	return m.writeFile(unpackedData, unpackFile)
+}
+
+// commitStaging moves the unpacked files from the staging directory to their
+// final location. It deliberately ignores cancellation, a half moved
+// destination is worse than finishing the last renames.
+func (m *ModUnpacker) commitStaging(stagingDir string) error {
+	return filepath.Walk(stagingDir, func(path string, f os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
-	}
-	return nil
+		if f.IsDir() {
+			return nil
+		}
+		relPath, err := filepath.Rel(stagingDir, path)
+		if err != nil {
+			return err
+		}
+		location := filepath.Join(m.unpackedWorkDirName, relPath)
+		if err := m.ensureDir(location); err != nil {
+			return err
+		}
+		return os.Rename(path, location)
+	})
 }
 
 type archiveFile struct {
@@ -90,16 +226,19 @@ func (m *ModUnpacker) getArchivedFilesPathsSizes(dir string) ([]*archiveFile, er
 		return nil, errors.New("provided path is not a directory")
 	}
 
-	// take the dir which is one above
-	dir = path.Dir(dir)
+	// paths are kept relative to the dir one above, so they start with the mod id
+	return m.listArchives(dir, filepath.Dir(dir))
+}
 
+// listArchives finds the archives in dir, their RelPath is relative to baseDir.
+func (m *ModUnpacker) listArchives(dir, baseDir string) ([]*archiveFile, error) {
 	archiveRegexp, e := regexp.Compile("^.+\\.(z)$")
 	if e != nil {
 		return nil, e
 	}
 	var archivedFilesPaths []*archiveFile
 
-	err = filepath.Walk(dir, func(path string, f os.FileInfo, err error) error {
+	err := filepath.Walk(dir, func(path string, f os.FileInfo, err error) error {
 		if archiveRegexp.MatchString(f.Name()) {
 			uncompressedSizeFilePath := fmt.Sprintf("%s.uncompressed_size", path)
 			fu, err := os.Open(uncompressedSizeFilePath)
@@ -117,7 +256,7 @@ func (m *ModUnpacker) getArchivedFilesPathsSizes(dir string) ([]*archiveFile, er
 					fmt.Printf("cannot get file size")
 				}
 			}
-			relPath, err := filepath.Rel(dir, path)
+			relPath, err := filepath.Rel(baseDir, path)
 			if err != nil {
 				return err
 			}
@@ -373,47 +512,6 @@ func (m *ModUnpacker) unpackModInfo(reader io.ReadCloser) ([]ue4String, error) {
 	return pairs, nil
 }
 
-func (m *ModUnpacker) createModFileData(mInfo []ue4String, mMInfo []modMetaInfo) []byte {
-	buff := bytes.Buffer{}
-
-	// modID with 4 padding bytes
-	binary.Write(&buff, binary.LittleEndian, uint32(m.modID))
-	binary.Write(&buff, binary.LittleEndian, []byte{0, 0, 0, 0})
-
-	binary.Write(&buff, binary.LittleEndian, newUE4String("ModName").Bytes())
-
-	binary.Write(&buff, binary.LittleEndian, newUE4String("").Bytes())
-
-	binary.Write(&buff, binary.LittleEndian, uint32(len(mInfo)))
-
-	for _, v := range mInfo {
-		binary.Write(&buff, binary.LittleEndian, newUE4String(v.text).Bytes())
-	}
-	// some static needed data
-	binary.Write(&buff, binary.LittleEndian, 4280483635)
-	// some static needed data again
-	binary.Write(&buff, binary.LittleEndian, 2)
-
-	modType := []byte{0}
-
-	for _, m := range mMInfo {
-		if m.key == "ModType" {
-			fmt.Printf("found ModType")
-			modType = []byte{1}
-		}
-	}
-	// can be tricky to be validated
-	binary.Write(&buff, binary.LittleEndian, modType)
-	binary.Write(&buff, binary.LittleEndian, 2)
-	binary.Write(&buff, binary.LittleEndian, len(mMInfo))
-	for _, d := range mMInfo {
-		binary.Write(&buff, binary.LittleEndian, newUE4String(d.key).Bytes())
-		binary.Write(&buff, binary.LittleEndian, newUE4String(d.value).Bytes())
-	}
-
-	return buff.Bytes()
-}
-
 type ue4String struct {
 	size int32
 	text string
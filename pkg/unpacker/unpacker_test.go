@@ -1,15 +1,35 @@
 package unpacker
 
 import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"math"
+	"os"
 	"path/filepath"
 	"reflect"
 	"strconv"
 	"testing"
 
+	"github.com/d8x/amm/pkg/diskspace"
 	"github.com/stretchr/testify/assert"
 )
 
+// fixtureModDir is the raw mod the fixture tests were written against, they
+// are skipped where it is not available.
+const fixtureModDir = "C:/dev/go/src/github.com/d8x/amm/workdir/rawmods/731604991"
+
+func requireFixture(t *testing.T) {
+	if _, err := os.Stat(fixtureModDir); err != nil {
+		t.Skipf("fixture %s is not available", fixtureModDir)
+	}
+}
+
 func TestModsUnpacker_getArchivedFilesPathsSizes(t *testing.T) {
+	requireFixture(t)
 	type fields struct {
 		rawModsDirName      string
 		unpackedWorkDirName string
@@ -65,7 +85,8 @@ func TestModsUnpacker_Unpack(t *testing.T) {
 }
 
 func TestModsUnpacker_unpackArchive(t *testing.T) {
-	unpacker, err := NewModsUnpacker("C:/dev/go/src/github.com/d8x/amm/workdir/rawmods/731604991", "amm-unpacked")
+	requireFixture(t)
+	unpacker, err := NewModsUnpacker("C:/dev/go/src/github.com/d8x/amm/workdir/rawmods/731604991", "amm-unpacked", nil)
 	if err != nil {
 		t.Error(err)
 	}
@@ -114,7 +135,8 @@ func Test_ue4String_Bytes(t *testing.T) {
 }
 
 func TestModUnpacker_createModFileData(t *testing.T) {
-	unpacker, err := NewModsUnpacker("C:/dev/go/src/github.com/d8x/amm/workdir/rawmods/731604991", "amm-unpacked")
+	requireFixture(t)
+	unpacker, err := NewModsUnpacker("C:/dev/go/src/github.com/d8x/amm/workdir/rawmods/731604991", "amm-unpacked", nil)
 	if err != nil {
 		t.Error(err)
 	}
@@ -143,8 +165,54 @@ func TestModUnpacker_createModFileData(t *testing.T) {
 	}
 }
 
+// TestModUnpacker_createModFileDataLayout checks the bytes of a .mod file
+// against the layout ARK writes.
+func TestModUnpacker_createModFileDataLayout(t *testing.T) {
+	header := []byte{
+		0xff, 0x67, 0x9b, 0x2b, 0, 0, 0, 0, // mod id 731604991 as uint64
+		8, 0, 0, 0, 'M', 'o', 'd', 'N', 'a', 'm', 'e', 0,
+		1, 0, 0, 0, 0, // empty mod path
+		1, 0, 0, 0, // one map
+		5, 0, 0, 0, 'M', 'a', 'p', '1', 0,
+		0x33, 0xff, 0x22, 0xff, // magic
+		2, 0, 0, 0,
+	}
+	tests := []struct {
+		name     string
+		meta     []modMetaInfo
+		expected []byte
+	}{
+		{"without meta data", nil, append(append([]byte{}, header...),
+			0, // mod type
+			2, 0, 0, 0,
+			0, 0, 0, 0, // no meta pairs
+		)},
+		{"with ModType", []modMetaInfo{{key: "ModType", value: "1"}}, append(append([]byte{}, header...),
+			1, // mod type
+			2, 0, 0, 0,
+			1, 0, 0, 0, // one meta pair
+			8, 0, 0, 0, 'M', 'o', 'd', 'T', 'y', 'p', 'e', 0,
+			2, 0, 0, 0, '1', 0,
+		)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			unpacker := &ModUnpacker{modID: 731604991}
+			data := unpacker.createModFileData([]ue4String{*newUE4String("Map1")}, tt.meta)
+			assert.Equal(t, tt.expected, data)
+
+			m, err := parseModFile(bytes.NewReader(data))
+			assert.NoError(t, err)
+			assert.Equal(t, int64(731604991), m.ID)
+			assert.Equal(t, []string{"Map1"}, m.Maps)
+			assert.Equal(t, tt.expected[len(header)], m.ModType)
+		})
+	}
+}
+
 func TestModUnpacker_unpackModMetaInfo(t *testing.T) {
-	unpacker, err := NewModsUnpacker("C:/dev/go/src/github.com/d8x/amm/workdir/rawmods/731604991", "amm-unpacked")
+	requireFixture(t)
+	unpacker, err := NewModsUnpacker("C:/dev/go/src/github.com/d8x/amm/workdir/rawmods/731604991", "amm-unpacked", nil)
 	if err != nil {
 		t.Error(err)
 	}
@@ -173,7 +241,8 @@ func TestModUnpacker_unpackModMetaInfo(t *testing.T) {
 }
 
 func TestModUnpacker_unpackModInfo(t *testing.T) {
-	unpacker, err := NewModsUnpacker("C:/dev/go/src/github.com/d8x/amm/workdir/rawmods/731604991", "amm-unpacked")
+	requireFixture(t)
+	unpacker, err := NewModsUnpacker("C:/dev/go/src/github.com/d8x/amm/workdir/rawmods/731604991", "amm-unpacked", nil)
 	if err != nil {
 		t.Error(err)
 	}
@@ -188,3 +257,360 @@ func TestModUnpacker_unpackModInfo(t *testing.T) {
 	assert.Equal(t, int32(18), modeData[0].size)
 	assert.Equal(t, "StructuresPlusMod", modeData[0].text)
 }
+
+// writeTestArchive writes data as an ARK .z archive with a single chunk.
+func writeTestArchive(t *testing.T, location string, data []byte) {
+	compressed := bytes.Buffer{}
+	z := zlib.NewWriter(&compressed)
+	if _, err := z.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	z.Close()
+	archive := bytes.Buffer{}
+	for _, v := range []int64{0x9E2A83C1, 131072, int64(compressed.Len()), int64(len(data)), int64(compressed.Len()), int64(len(data))} {
+		binary.Write(&archive, binary.LittleEndian, v)
+	}
+	archive.Write(compressed.Bytes())
+	if err := os.MkdirAll(filepath.Dir(location), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(location, archive.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(location+".uncompressed_size", []byte(strconv.Itoa(len(data))), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestModUnpacker_UnpackContext(t *testing.T) {
+	dir := t.TempDir()
+	rawModDir := filepath.Join(dir, "raw", "731604991")
+	writeTestArchive(t, filepath.Join(rawModDir, "WindowsNoEditor", "Buzz.uasset.z"), []byte("buzz"))
+	writeTestArchive(t, filepath.Join(rawModDir, "WindowsNoEditor", "Maps", "Map.umap.z"), []byte("map"))
+	unpackDir := filepath.Join(dir, "unpacked")
+
+	unpacker, err := NewModsUnpacker(rawModDir, unpackDir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Equal(t, context.Canceled, unpacker.Unpack(ctx))
+	entries, err := ioutil.ReadDir(unpackDir)
+	assert.NoError(t, err)
+	assert.Empty(t, entries, "cancelled unpack must not touch the destination")
+
+	assert.NoError(t, unpacker.Unpack(context.Background()))
+	got, err := ioutil.ReadFile(filepath.Join(unpackDir, "731604991", "WindowsNoEditor", "Buzz.uasset"))
+	assert.NoError(t, err)
+	assert.Equal(t, "buzz", string(got))
+	got, err = ioutil.ReadFile(filepath.Join(unpackDir, "731604991", "WindowsNoEditor", "Maps", "Map.umap"))
+	assert.NoError(t, err)
+	assert.Equal(t, "map", string(got))
+}
+
+// writeTestModInfo writes a mod.info listing maps and a modmeta.info with meta.
+func writeTestModInfo(t *testing.T, dir string, maps []string, meta map[string]string) {
+	modInfo := bytes.Buffer{}
+	modInfo.Write(newUE4String("TestMod").Bytes())
+	binary.Write(&modInfo, binary.LittleEndian, int32(len(maps)))
+	for _, m := range maps {
+		modInfo.Write(newUE4String(m).Bytes())
+	}
+	modMetaInfo := bytes.Buffer{}
+	binary.Write(&modMetaInfo, binary.LittleEndian, int32(len(meta)))
+	for k, v := range meta {
+		binary.Write(&modMetaInfo, binary.LittleEndian, int32(len(k)))
+		modMetaInfo.WriteString(k)
+		binary.Write(&modMetaInfo, binary.LittleEndian, int32(len(v)))
+		modMetaInfo.WriteString(v)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "mod.info"), modInfo.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "modmeta.info"), modMetaInfo.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestModUnpacker_Install(t *testing.T) {
+	dir := t.TempDir()
+	rawModDir := filepath.Join(dir, "raw", "2812427232")
+	platformDir := filepath.Join(rawModDir, "WindowsNoEditor")
+	writeTestArchive(t, filepath.Join(platformDir, "Maps", "Map.umap.z"), []byte("map"))
+	writeTestModInfo(t, platformDir, []string{"Map"}, map[string]string{"ModType": "1"})
+	if err := ioutil.WriteFile(filepath.Join(platformDir, "PrimalGameData.uasset"), []byte("plain"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	modsDir := filepath.Join(dir, "server", "ShooterGame", "Content", "Mods")
+	stale := filepath.Join(modsDir, "2812427232", "Removed.uasset")
+	if err := os.MkdirAll(filepath.Dir(stale), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(stale, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	unpacker, err := NewModsUnpacker(rawModDir, filepath.Join(dir, "unpacked"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := unpacker.Install(context.Background(), modsDir); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadFile(filepath.Join(modsDir, "2812427232", "Maps", "Map.umap"))
+	assert.NoError(t, err)
+	assert.Equal(t, "map", string(got))
+	got, err = ioutil.ReadFile(filepath.Join(modsDir, "2812427232", "PrimalGameData.uasset"))
+	assert.NoError(t, err)
+	assert.Equal(t, "plain", string(got))
+	assert.FileExists(t, filepath.Join(modsDir, "2812427232", "mod.info"))
+	_, err = os.Stat(filepath.Join(modsDir, "2812427232", "Maps", "Map.umap.z.uncompressed_size"))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(stale)
+	assert.True(t, os.IsNotExist(err), "files of the previous version must be removed")
+
+	modFile, err := ioutil.ReadFile(filepath.Join(modsDir, "2812427232.mod"))
+	assert.NoError(t, err)
+	var modID uint64
+	assert.NoError(t, binary.Read(bytes.NewReader(modFile), binary.LittleEndian, &modID))
+	assert.Equal(t, uint64(2812427232), modID)
+	assert.True(t, bytes.Contains(modFile, newUE4String("ModType").Bytes()))
+
+	entries, err := ioutil.ReadDir(modsDir)
+	assert.NoError(t, err)
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	assert.Equal(t, []string{manifestDirName, "2812427232", "2812427232.mod"}, names, "staging data must be removed")
+
+	problems, err := Verify(modsDir, "2812427232")
+	assert.NoError(t, err)
+	assert.Empty(t, problems)
+}
+
+func TestModUnpacker_platformDir(t *testing.T) {
+	rawModDir := filepath.Join(t.TempDir(), "731604991")
+	for _, name := range []string{"WindowsNoEditor", "LinuxNoEditor"} {
+		if err := os.MkdirAll(filepath.Join(rawModDir, name), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	unpacker, err := NewModsUnpacker(rawModDir, t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for platform, want := range map[string]string{"": "WindowsNoEditor", "windows": "WindowsNoEditor", "linux": "LinuxNoEditor"} {
+		unpacker.Platform = platform
+		dir, err := unpacker.platformDir()
+		assert.NoError(t, err)
+		assert.Equal(t, want, filepath.Base(dir), platform)
+	}
+
+	// mods without content for the platform fall back to the other one
+	if err := os.Remove(filepath.Join(rawModDir, "LinuxNoEditor")); err != nil {
+		t.Fatal(err)
+	}
+	unpacker.Platform = "linux"
+	dir, err := unpacker.platformDir()
+	assert.NoError(t, err)
+	assert.Equal(t, "WindowsNoEditor", filepath.Base(dir))
+}
+
+func TestReadModFile(t *testing.T) {
+	unpacker := &ModUnpacker{modID: 2812427232}
+	data := unpacker.createModFileData(
+		[]ue4String{*newUE4String("Map"), *newUE4String("Map_P")},
+		[]modMetaInfo{{key: "ModType", value: "1"}},
+	)
+	location := filepath.Join(t.TempDir(), "2812427232.mod")
+	if err := ioutil.WriteFile(location, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	m, err := ReadModFile(location)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, &ModFile{
+		ID:      2812427232,
+		Name:    "ModName",
+		Maps:    []string{"Map", "Map_P"},
+		ModType: 1,
+		Meta:    map[string]string{"ModType": "1"},
+	}, m)
+
+	if err := ioutil.WriteFile(location, data[:10], 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err = ReadModFile(location)
+	assert.Error(t, err)
+}
+
+func TestDiff(t *testing.T) {
+	dir := t.TempDir()
+	oldDir := filepath.Join(dir, "old", "731604991")
+	writeTestArchive(t, filepath.Join(oldDir, "WindowsNoEditor", "Buzz.uasset.z"), []byte("buzz"))
+	writeTestArchive(t, filepath.Join(oldDir, "WindowsNoEditor", "Maps", "Map.umap.z"), []byte("map"))
+	writeTestArchive(t, filepath.Join(oldDir, "WindowsNoEditor", "Old.uasset.z"), []byte("old"))
+	newDir := filepath.Join(dir, "new", "731604991")
+	writeTestArchive(t, filepath.Join(newDir, "WindowsNoEditor", "Buzz.uasset.z"), []byte("buzz"))
+	writeTestArchive(t, filepath.Join(newDir, "WindowsNoEditor", "Maps", "Map.umap.z"), []byte("map v2"))
+	writeTestArchive(t, filepath.Join(newDir, "WindowsNoEditor", "New.uasset.z"), []byte("new"))
+
+	changes, err := Diff(oldDir, newDir, "windows")
+	assert.NoError(t, err)
+	assert.Equal(t, []FileChange{
+		{Path: "Maps/Map.umap", Kind: FileChanged, OldSize: 3, NewSize: 6},
+		{Path: "New.uasset", Kind: FileAdded, NewSize: 3},
+		{Path: "Old.uasset", Kind: FileRemoved, OldSize: 3},
+	}, changes)
+	assert.Equal(t, int64(3), changes[0].Delta())
+
+	installed := filepath.Join(dir, "Mods", "731604991")
+	for name, content := range map[string]string{"Buzz.uasset": "buzz", "Maps/Map.umap": "mop", "Old.uasset": "old"} {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(installed, name)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(installed, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	changes, err = Diff(oldDir, installed, "windows")
+	assert.NoError(t, err)
+	assert.Equal(t, []FileChange{{Path: "Maps/Map.umap", Kind: FileChanged, OldSize: 3, NewSize: 3}}, changes,
+		"archives are decompressed to compare them to unpacked files of the same size")
+}
+
+func TestModUnpacker_UnpackIncremental(t *testing.T) {
+	dir := t.TempDir()
+	rawModDir := filepath.Join(dir, "raw", "731604991")
+	writeTestArchive(t, filepath.Join(rawModDir, "WindowsNoEditor", "Buzz.uasset.z"), []byte("buzz"))
+	writeTestArchive(t, filepath.Join(rawModDir, "WindowsNoEditor", "Maps", "Map.umap.z"), []byte("map"))
+	unpackDir := filepath.Join(dir, "unpacked")
+	unpacker, err := NewModsUnpacker(rawModDir, unpackDir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unpacker.Incremental = true
+	assert.NoError(t, unpacker.Unpack(context.Background()))
+
+	// a marker shows whether the unchanged archive is unpacked again
+	buzz := filepath.Join(unpackDir, "731604991", "WindowsNoEditor", "Buzz.uasset")
+	if err := ioutil.WriteFile(buzz, []byte("kept"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	writeTestArchive(t, filepath.Join(rawModDir, "WindowsNoEditor", "New.uasset.z"), []byte("new"))
+	if err := os.RemoveAll(filepath.Join(rawModDir, "WindowsNoEditor", "Maps")); err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, unpacker.Unpack(context.Background()))
+	got, err := ioutil.ReadFile(buzz)
+	assert.NoError(t, err)
+	assert.Equal(t, "kept", string(got), "unchanged archives are skipped")
+	assert.FileExists(t, filepath.Join(unpackDir, "731604991", "WindowsNoEditor", "New.uasset"))
+	_, err = os.Stat(filepath.Join(unpackDir, "731604991", "WindowsNoEditor", "Maps"))
+	assert.True(t, os.IsNotExist(err), "files of removed archives and their empty folders are deleted")
+	problems, err := Verify(unpackDir, "731604991")
+	assert.NoError(t, err)
+	assert.Equal(t, []Problem{{Path: "WindowsNoEditor/Buzz.uasset", Kind: FileModified}}, problems,
+		"hashes of skipped archives are kept from the last unpack")
+
+	unpacker.Incremental = false
+	assert.NoError(t, unpacker.Unpack(context.Background()))
+	got, err = ioutil.ReadFile(buzz)
+	assert.NoError(t, err)
+	assert.Equal(t, "buzz", string(got))
+	_, err = os.Stat(unpacker.indexPath())
+	assert.True(t, os.IsNotExist(err), "a full unpack drops the index")
+}
+
+func TestVerify(t *testing.T) {
+	root := t.TempDir()
+	modDir := filepath.Join(root, "731604991")
+	for name, content := range map[string]string{"Buzz.uasset": "buzz", "Maps/Map.umap": "map", "Old.uasset": "old"} {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(modDir, name)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(modDir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(root, "731604991.mod"), []byte("mod"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := Verify(root, "731604991")
+	assert.Equal(t, ErrNoManifest, err)
+	assert.NoError(t, WriteManifest(root, "731604991"))
+	ids, err := ManifestIDs(root)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"731604991"}, ids)
+
+	if err := ioutil.WriteFile(filepath.Join(modDir, "Buzz.uasset"), []byte("fizz"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(modDir, "New.uasset"), []byte("new"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(modDir, "Old.uasset")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(root, "731604991.mod")); err != nil {
+		t.Fatal(err)
+	}
+	problems, err := Verify(root, "731604991")
+	assert.NoError(t, err)
+	assert.Equal(t, []Problem{
+		{Path: "731604991.mod", Kind: FileMissing},
+		{Path: "Buzz.uasset", Kind: FileModified},
+		{Path: "New.uasset", Kind: FileExtra},
+		{Path: "Old.uasset", Kind: FileMissing},
+	}, problems)
+
+	assert.NoError(t, RemoveManifest(root, "731604991"))
+	ids, err = ManifestIDs(root)
+	assert.NoError(t, err)
+	assert.Empty(t, ids)
+}
+
+func TestModUnpacker_CheckSpace(t *testing.T) {
+	dir := t.TempDir()
+	rawModDir := filepath.Join(dir, "raw", "731604991")
+	platformDir := filepath.Join(rawModDir, "WindowsNoEditor")
+	writeTestArchive(t, filepath.Join(platformDir, "Buzz.uasset.z"), []byte("buzz"))
+	writeTestArchive(t, filepath.Join(rawModDir, "LinuxNoEditor", "Buzz.uasset.z"), []byte("buzz"))
+	writeTestModInfo(t, platformDir, nil, nil)
+	if err := os.Remove(filepath.Join(platformDir, "Buzz.uasset.z.uncompressed_size")); err != nil {
+		t.Fatal(err)
+	}
+	unpackDir := filepath.Join(dir, "unpacked")
+	unpacker, err := NewModsUnpacker(rawModDir, unpackDir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	size, err := unpacker.UnpackSize()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(8), size, "the header is read without .uncompressed_size")
+	size, err = unpacker.InstallSize()
+	assert.NoError(t, err)
+	plainSize := int64(0)
+	for _, name := range []string{"mod.info", "modmeta.info"} {
+		stat, err := os.Stat(filepath.Join(platformDir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		plainSize += stat.Size()
+	}
+	assert.Equal(t, 4+plainSize, size, "only the platform folder is installed")
+
+	unpacker.MinFree = math.MaxInt64 / 2
+	var spaceErr *diskspace.InsufficientSpaceError
+	assert.True(t, errors.As(unpacker.Unpack(context.Background()), &spaceErr))
+	modsDir := filepath.Join(dir, "Mods")
+	assert.True(t, errors.As(unpacker.Install(context.Background(), modsDir), &spaceErr))
+	entries, err := ioutil.ReadDir(unpackDir)
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+	_, err = os.Stat(filepath.Join(modsDir, "731604991"))
+	assert.True(t, os.IsNotExist(err))
+}
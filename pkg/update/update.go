@@ -0,0 +1,96 @@
+// Package update finds installed workshop mods with a newer published version.
+package update
+
+import (
+	"context"
+	"sort"
+)
+
+// Version identifies one published version of a workshop item. Manifest may
+// be empty when the source only knows the update time.
+type Version struct {
+	TimeUpdated int64
+	Manifest    string
+}
+
+// Source looks up the latest published versions of workshop items. Items
+// the source does not know are left out of the result.
+type Source interface {
+	Latest(ctx context.Context, modIDs []string) (map[string]Version, error)
+}
+
+// Status compares the installed and the latest version of a mod.
+type Status struct {
+	ModID string
+	// Target is where the mod is installed, empty for Check.
+	Target    string
+	Installed Version
+	Latest    Version
+	// Known is false when the source had no information about the mod.
+	Known    bool
+	Outdated bool
+}
+
+// Check looks up the latest version of every installed mod. The result is
+// sorted by mod id.
+func Check(ctx context.Context, source Source, installed map[string]Version) ([]Status, error) {
+	return CheckTargets(ctx, source, map[string]map[string]Version{"": installed})
+}
+
+// CheckTargets compares the mods installed in several targets, keyed by
+// target and mod id, with their latest versions, which are looked up once.
+// The result is sorted by target and mod id.
+func CheckTargets(ctx context.Context, source Source, installed map[string]map[string]Version) ([]Status, error) {
+	targets := make([]string, 0, len(installed))
+	seen := map[string]bool{}
+	var modIDs []string
+	for target, mods := range installed {
+		targets = append(targets, target)
+		for id := range mods {
+			if !seen[id] {
+				seen[id] = true
+				modIDs = append(modIDs, id)
+			}
+		}
+	}
+	sort.Strings(targets)
+	sort.Strings(modIDs)
+	latest, err := source.Latest(ctx, modIDs)
+	if err != nil {
+		return nil, err
+	}
+	var statuses []Status
+	for _, target := range targets {
+		for _, id := range modIDs {
+			version, ok := installed[target][id]
+			if !ok {
+				continue
+			}
+			status := Status{ModID: id, Target: target, Installed: version}
+			status.Latest, status.Known = latest[id]
+			status.Outdated = status.Known && isNewer(status.Installed, status.Latest)
+			statuses = append(statuses, status)
+		}
+	}
+	return statuses, nil
+}
+
+// Outdated returns the ids of the outdated mods in statuses.
+func Outdated(statuses []Status) []string {
+	var modIDs []string
+	for _, s := range statuses {
+		if s.Outdated {
+			modIDs = append(modIDs, s.ModID)
+		}
+	}
+	return modIDs
+}
+
+// isNewer prefers the manifest ids, which change with every published
+// version, and falls back to the update timestamps.
+func isNewer(installed, latest Version) bool {
+	if installed.Manifest != "" && latest.Manifest != "" {
+		return installed.Manifest != latest.Manifest
+	}
+	return latest.TimeUpdated > installed.TimeUpdated
+}
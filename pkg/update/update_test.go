@@ -0,0 +1,95 @@
+package update
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeSource map[string]Version
+
+func (f fakeSource) Latest(ctx context.Context, modIDs []string) (map[string]Version, error) {
+	latest := map[string]Version{}
+	for _, id := range modIDs {
+		if v, ok := f[id]; ok {
+			latest[id] = v
+		}
+	}
+	return latest, nil
+}
+
+type failingSource struct{}
+
+func (failingSource) Latest(ctx context.Context, modIDs []string) (map[string]Version, error) {
+	return nil, errors.New("steam is down")
+}
+
+func TestCheck(t *testing.T) {
+	installed := map[string]Version{
+		"731604991": {TimeUpdated: 100, Manifest: "1"},
+		"889745138": {TimeUpdated: 100, Manifest: "1"},
+		"751991809": {TimeUpdated: 100},
+		"812655342": {TimeUpdated: 100},
+		"520879363": {TimeUpdated: 100},
+	}
+	source := fakeSource{
+		"731604991": {TimeUpdated: 100, Manifest: "2"},
+		"889745138": {TimeUpdated: 200, Manifest: "1"},
+		"751991809": {TimeUpdated: 200, Manifest: "7"},
+		"812655342": {TimeUpdated: 100},
+	}
+	statuses, err := Check(context.Background(), source, installed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []Status{
+		{ModID: "520879363", Installed: Version{TimeUpdated: 100}},
+		{ModID: "731604991", Installed: Version{100, "1"}, Latest: Version{100, "2"}, Known: true, Outdated: true},
+		{ModID: "751991809", Installed: Version{TimeUpdated: 100}, Latest: Version{200, "7"}, Known: true, Outdated: true},
+		{ModID: "812655342", Installed: Version{TimeUpdated: 100}, Latest: Version{TimeUpdated: 100}, Known: true},
+		{ModID: "889745138", Installed: Version{100, "1"}, Latest: Version{200, "1"}, Known: true},
+	}, statuses)
+	assert.Equal(t, []string{"731604991", "751991809"}, Outdated(statuses))
+
+	_, err = Check(context.Background(), failingSource{}, installed)
+	assert.Error(t, err)
+}
+
+// countingSource counts the lookups of the wrapped source.
+type countingSource struct {
+	fakeSource
+	calls int
+}
+
+func (c *countingSource) Latest(ctx context.Context, modIDs []string) (map[string]Version, error) {
+	c.calls++
+	return c.fakeSource.Latest(ctx, modIDs)
+}
+
+func TestCheckTargets(t *testing.T) {
+	installed := map[string]map[string]Version{
+		"/srv/ark/ShooterGame/Content/Mods": {
+			"731604991": {TimeUpdated: 100, Manifest: "1"},
+			"889745138": {TimeUpdated: 200, Manifest: "2"},
+		},
+		"/srv/amm-unpacked": {
+			"731604991": {TimeUpdated: 200, Manifest: "2"},
+		},
+	}
+	source := &countingSource{fakeSource: fakeSource{
+		"731604991": {TimeUpdated: 200, Manifest: "2"},
+		"889745138": {TimeUpdated: 200, Manifest: "2"},
+	}}
+	statuses, err := CheckTargets(context.Background(), source, installed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 1, source.calls, "latest versions are looked up once")
+	assert.Equal(t, []Status{
+		{ModID: "731604991", Target: "/srv/amm-unpacked", Installed: Version{200, "2"}, Latest: Version{200, "2"}, Known: true},
+		{ModID: "731604991", Target: "/srv/ark/ShooterGame/Content/Mods", Installed: Version{100, "1"}, Latest: Version{200, "2"}, Known: true, Outdated: true},
+		{ModID: "889745138", Target: "/srv/ark/ShooterGame/Content/Mods", Installed: Version{200, "2"}, Latest: Version{200, "2"}, Known: true},
+	}, statuses)
+}
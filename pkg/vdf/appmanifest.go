@@ -0,0 +1,74 @@
+package vdf
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// AppState is the typed view of an appmanifest_<appid>.acf file steamcmd
+// writes for an installed app.
+type AppState struct {
+	AppID         string
+	Name          string
+	InstallDir    string
+	StateFlags    int64
+	LastUpdated   int64
+	BuildID       string
+	TargetBuildID string
+	// BetaKey is the branch the app is installed from, empty for public.
+	BetaKey    string
+	SizeOnDisk int64
+}
+
+// ReadAppManifestFile parses the acf file at location.
+func ReadAppManifestFile(location string) (*AppState, error) {
+	f, err := os.Open(location)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseAppManifest(f)
+}
+
+func ParseAppManifest(r io.Reader) (*AppState, error) {
+	doc, err := Parse(r)
+	if err != nil {
+		return nil, err
+	}
+	root := doc.Child("AppState")
+	if root == nil {
+		return nil, fmt.Errorf("%w: AppState", ErrNotFound)
+	}
+	a := &AppState{
+		AppID:         root.String("appid"),
+		Name:          root.String("name"),
+		InstallDir:    root.String("installdir"),
+		StateFlags:    optionalInt64(root, "StateFlags"),
+		LastUpdated:   optionalInt64(root, "LastUpdated"),
+		BuildID:       root.String("buildid"),
+		TargetBuildID: root.String("TargetBuildID"),
+		SizeOnDisk:    optionalInt64(root, "SizeOnDisk"),
+	}
+	if config := root.Child("UserConfig"); config != nil {
+		a.BetaKey = config.String("betakey")
+	}
+	return a, nil
+}
+
+// BranchBuildID returns the build id of a branch from the output of
+// app_info_print, the public branch is used when branch is empty.
+func BranchBuildID(appInfo *Node, branch string) (string, error) {
+	if branch == "" {
+		branch = "public"
+	}
+	b := appInfo.Path("depots", "branches", branch)
+	if b == nil {
+		return "", fmt.Errorf("%w: branch %s", ErrNotFound, branch)
+	}
+	buildID := b.String("buildid")
+	if buildID == "" {
+		return "", fmt.Errorf("%w: buildid of branch %s", ErrNotFound, branch)
+	}
+	return buildID, nil
+}
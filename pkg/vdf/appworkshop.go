@@ -0,0 +1,137 @@
+package vdf
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+)
+
+// WorkshopItemInstalled is an entry of the WorkshopItemsInstalled section of
+// an appworkshop_<appid>.acf file, describing the content on disk.
+type WorkshopItemInstalled struct {
+	ID          string
+	Size        int64
+	TimeUpdated int64
+	Manifest    string
+}
+
+// WorkshopItemDetails is an entry of the WorkshopItemDetails section, it also
+// holds what steamcmd knows about the latest published version.
+type WorkshopItemDetails struct {
+	ID                string
+	Manifest          string
+	TimeUpdated       int64
+	TimeTouched       int64
+	LatestTimeUpdated int64
+	LatestManifest    string
+}
+
+// AppWorkshop is the typed view of an appworkshop_<appid>.acf state file.
+type AppWorkshop struct {
+	AppID                  string
+	SizeOnDisk             int64
+	WorkshopItemsInstalled map[string]WorkshopItemInstalled
+	WorkshopItemDetails    map[string]WorkshopItemDetails
+}
+
+// ReadAppWorkshopFile parses the acf file at location.
+func ReadAppWorkshopFile(location string) (*AppWorkshop, error) {
+	f, err := os.Open(location)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseAppWorkshop(f)
+}
+
+func ParseAppWorkshop(r io.Reader) (*AppWorkshop, error) {
+	doc, err := Parse(r)
+	if err != nil {
+		return nil, err
+	}
+	root := doc.Child("AppWorkshop")
+	if root == nil {
+		return nil, fmt.Errorf("%w: AppWorkshop", ErrNotFound)
+	}
+	a := &AppWorkshop{
+		AppID:                  root.String("appid"),
+		SizeOnDisk:             optionalInt64(root, "SizeOnDisk"),
+		WorkshopItemsInstalled: map[string]WorkshopItemInstalled{},
+		WorkshopItemDetails:    map[string]WorkshopItemDetails{},
+	}
+	if installed := root.Child("WorkshopItemsInstalled"); installed != nil {
+		for _, item := range installed.Children {
+			a.WorkshopItemsInstalled[item.Key] = WorkshopItemInstalled{
+				ID:          item.Key,
+				Size:        optionalInt64(item, "size"),
+				TimeUpdated: optionalInt64(item, "timeupdated"),
+				Manifest:    item.String("manifest"),
+			}
+		}
+	}
+	if details := root.Child("WorkshopItemDetails"); details != nil {
+		for _, item := range details.Children {
+			a.WorkshopItemDetails[item.Key] = WorkshopItemDetails{
+				ID:                item.Key,
+				Manifest:          item.String("manifest"),
+				TimeUpdated:       optionalInt64(item, "timeupdated"),
+				TimeTouched:       optionalInt64(item, "timetouched"),
+				LatestTimeUpdated: optionalInt64(item, "latest_timeupdated"),
+				LatestManifest:    item.String("latest_manifest"),
+			}
+		}
+	}
+	return a, nil
+}
+
+// Node converts the state back into a document which can be passed to Write.
+func (a *AppWorkshop) Node() *Node {
+	root := NewObject("AppWorkshop")
+	root.Set("appid", a.AppID)
+	root.Set("SizeOnDisk", strconv.FormatInt(a.SizeOnDisk, 10))
+	installed := NewObject("WorkshopItemsInstalled")
+	var ids []string
+	for id := range a.WorkshopItemsInstalled {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		item := a.WorkshopItemsInstalled[id]
+		n := NewObject(id)
+		n.Set("size", strconv.FormatInt(item.Size, 10))
+		n.Set("timeupdated", strconv.FormatInt(item.TimeUpdated, 10))
+		n.Set("manifest", item.Manifest)
+		installed.Add(n)
+	}
+	root.Add(installed)
+	details := NewObject("WorkshopItemDetails")
+	ids = ids[:0]
+	for id := range a.WorkshopItemDetails {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		item := a.WorkshopItemDetails[id]
+		n := NewObject(id)
+		n.Set("manifest", item.Manifest)
+		n.Set("timeupdated", strconv.FormatInt(item.TimeUpdated, 10))
+		n.Set("timetouched", strconv.FormatInt(item.TimeTouched, 10))
+		n.Set("latest_timeupdated", strconv.FormatInt(item.LatestTimeUpdated, 10))
+		n.Set("latest_manifest", item.LatestManifest)
+		details.Add(n)
+	}
+	root.Add(details)
+	doc := NewObject("")
+	doc.Add(root)
+	return doc
+}
+
+func optionalInt64(n *Node, key string) int64 {
+	v, err := n.Int64(key)
+	if err != nil {
+		return 0
+	}
+	return v
+}
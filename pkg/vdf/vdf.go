@@ -0,0 +1,347 @@
+// Package vdf reads and writes Valve's text KeyValues format, used by steamcmd
+// for its .vdf config and .acf state files.
+package vdf
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+var ErrNotFound = errors.New("key not found")
+
+// Node is a single KeyValues entry. It either holds a string Value or, when
+// it is an object, a list of Children. Children keep the order of the file.
+type Node struct {
+	Key      string
+	Value    string
+	Children []*Node
+	object   bool
+}
+
+// NewObject creates an empty object node.
+func NewObject(key string) *Node {
+	return &Node{Key: key, object: true}
+}
+
+// NewValue creates a node holding a string value.
+func NewValue(key, value string) *Node {
+	return &Node{Key: key, Value: value}
+}
+
+func (n *Node) IsObject() bool {
+	return n.object
+}
+
+// Child returns the first child with the given key. Keys are compared case
+// insensitive, like steam does.
+func (n *Node) Child(key string) *Node {
+	if n == nil {
+		return nil
+	}
+	for _, c := range n.Children {
+		if strings.EqualFold(c.Key, key) {
+			return c
+		}
+	}
+	return nil
+}
+
+// Path follows the given keys down the tree.
+func (n *Node) Path(keys ...string) *Node {
+	for _, k := range keys {
+		n = n.Child(k)
+	}
+	return n
+}
+
+// String returns the value of the child key, or an empty string if it is missing.
+func (n *Node) String(key string) string {
+	c := n.Child(key)
+	if c == nil {
+		return ""
+	}
+	return c.Value
+}
+
+// Int64 returns the value of the child key parsed as an integer.
+func (n *Node) Int64(key string) (int64, error) {
+	c := n.Child(key)
+	if c == nil || c.object {
+		return 0, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	return strconv.ParseInt(c.Value, 10, 64)
+}
+
+// Set replaces the value of the child key or appends a new child.
+func (n *Node) Set(key, value string) {
+	if c := n.Child(key); c != nil && !c.object {
+		c.Value = value
+		return
+	}
+	n.Add(NewValue(key, value))
+}
+
+// Add appends child to the object node.
+func (n *Node) Add(child *Node) {
+	n.object = true
+	n.Children = append(n.Children, child)
+}
+
+// Remove deletes all children with the given key.
+func (n *Node) Remove(key string) {
+	children := n.Children[:0]
+	for _, c := range n.Children {
+		if !strings.EqualFold(c.Key, key) {
+			children = append(children, c)
+		}
+	}
+	n.Children = children
+}
+
+// Parse reads a KeyValues document. The returned node is an unnamed object
+// holding all top level entries of the document.
+func Parse(r io.Reader) (*Node, error) {
+	p := &parser{lexer: newLexer(r)}
+	root := NewObject("")
+	if err := p.parseChildren(root, false); err != nil {
+		return nil, err
+	}
+	return root, nil
+}
+
+type parser struct {
+	lexer *lexer
+}
+
+func (p *parser) parseChildren(parent *Node, nested bool) error {
+	for {
+		tok, err := p.lexer.next()
+		if err == io.EOF {
+			if nested {
+				return p.lexer.errorf("unexpected end of file, missing }")
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch tok.kind {
+		case tokenClose:
+			if !nested {
+				return p.lexer.errorf("unexpected }")
+			}
+			return nil
+		case tokenOpen:
+			return p.lexer.errorf("unexpected {, missing key")
+		}
+		key := tok.text
+		tok, err = p.lexer.next()
+		if err == io.EOF {
+			return p.lexer.errorf("unexpected end of file, missing value for %q", key)
+		}
+		if err != nil {
+			return err
+		}
+		switch tok.kind {
+		case tokenString:
+			parent.Add(NewValue(key, tok.text))
+		case tokenOpen:
+			child := NewObject(key)
+			if err := p.parseChildren(child, true); err != nil {
+				return err
+			}
+			parent.Add(child)
+		default:
+			return p.lexer.errorf("unexpected } after key %q", key)
+		}
+	}
+}
+
+type tokenKind int
+
+const (
+	tokenString tokenKind = iota
+	tokenOpen
+	tokenClose
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+type lexer struct {
+	reader *bufio.Reader
+	line   int
+}
+
+func newLexer(r io.Reader) *lexer {
+	return &lexer{reader: bufio.NewReader(r), line: 1}
+}
+
+func (l *lexer) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("vdf: line %d: %s", l.line, fmt.Sprintf(format, args...))
+}
+
+func (l *lexer) read() (rune, error) {
+	r, _, err := l.reader.ReadRune()
+	if r == '\n' {
+		l.line++
+	}
+	return r, err
+}
+
+func (l *lexer) unread(r rune) {
+	if r == '\n' {
+		l.line--
+	}
+	l.reader.UnreadRune()
+}
+
+func (l *lexer) next() (token, error) {
+	for {
+		r, err := l.read()
+		if err != nil {
+			return token{}, err
+		}
+		switch {
+		case r == ' ' || r == '\t' || r == '\r' || r == '\n' || r == '\uFEFF':
+			continue
+		case r == '{':
+			return token{kind: tokenOpen}, nil
+		case r == '}':
+			return token{kind: tokenClose}, nil
+		case r == '"':
+			return l.quoted()
+		case r == '/':
+			next, err := l.read()
+			if err != nil || next != '/' {
+				return token{}, l.errorf("unexpected /")
+			}
+			if err := l.skipLine(); err != nil {
+				return token{}, err
+			}
+		case r == '[':
+			// conditionals like [$WIN32] are not evaluated
+			if err := l.skipConditional(); err != nil {
+				return token{}, err
+			}
+		default:
+			l.unread(r)
+			return l.unquoted()
+		}
+	}
+}
+
+func (l *lexer) quoted() (token, error) {
+	b := strings.Builder{}
+	for {
+		r, err := l.read()
+		if err == io.EOF {
+			return token{}, l.errorf("unterminated string")
+		}
+		if err != nil {
+			return token{}, err
+		}
+		switch r {
+		case '"':
+			return token{kind: tokenString, text: b.String()}, nil
+		case '\\':
+			e, err := l.read()
+			if err != nil {
+				return token{}, l.errorf("unterminated string")
+			}
+			switch e {
+			case 'n':
+				b.WriteRune('\n')
+			case 't':
+				b.WriteRune('\t')
+			case '\\', '"':
+				b.WriteRune(e)
+			default:
+				b.WriteRune('\\')
+				b.WriteRune(e)
+			}
+		default:
+			b.WriteRune(r)
+		}
+	}
+}
+
+func (l *lexer) unquoted() (token, error) {
+	b := strings.Builder{}
+	for {
+		r, err := l.read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return token{}, err
+		}
+		if r == ' ' || r == '\t' || r == '\r' || r == '\n' || r == '{' || r == '}' || r == '"' {
+			l.unread(r)
+			break
+		}
+		b.WriteRune(r)
+	}
+	return token{kind: tokenString, text: b.String()}, nil
+}
+
+func (l *lexer) skipLine() error {
+	for {
+		r, err := l.read()
+		if err == io.EOF || r == '\n' {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (l *lexer) skipConditional() error {
+	for {
+		r, err := l.read()
+		if err == io.EOF {
+			return l.errorf("unterminated conditional")
+		}
+		if err != nil {
+			return err
+		}
+		if r == ']' {
+			return nil
+		}
+	}
+}
+
+// Write encodes the children of root in the tab indented layout steamcmd uses.
+func Write(w io.Writer, root *Node) error {
+	bw := bufio.NewWriter(w)
+	for _, c := range root.Children {
+		writeNode(bw, c, 0)
+	}
+	return bw.Flush()
+}
+
+func writeNode(w *bufio.Writer, n *Node, depth int) {
+	indent := strings.Repeat("\t", depth)
+	if !n.object {
+		fmt.Fprintf(w, "%s%s\t\t%s\n", indent, quote(n.Key), quote(n.Value))
+		return
+	}
+	fmt.Fprintf(w, "%s%s\n%s{\n", indent, quote(n.Key), indent)
+	for _, c := range n.Children {
+		writeNode(w, c, depth+1)
+	}
+	fmt.Fprintf(w, "%s}\n", indent)
+}
+
+var escaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\t", `\t`)
+
+func quote(s string) string {
+	return `"` + escaper.Replace(s) + `"`
+}
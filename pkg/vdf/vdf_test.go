@@ -0,0 +1,144 @@
+package vdf
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		check   func(t *testing.T, root *Node)
+		wantErr bool
+	}{
+		{
+			name: "nested with comments and escapes",
+			input: `// steamcmd config
+"InstallConfigStore"
+{
+	"Software" { "Valve" { "Steam" { "CellID" "64" "Path" "C:\\Steam" } } }
+	unquoted value [$WIN32]
+	"quote" "say \"hi\""
+}`,
+			check: func(t *testing.T, root *Node) {
+				store := root.Child("installconfigstore")
+				assert.Equal(t, "64", store.Path("Software", "Valve", "Steam").String("CellID"))
+				assert.Equal(t, `C:\Steam`, store.Path("Software", "Valve", "Steam").String("Path"))
+				assert.Equal(t, "value", store.String("unquoted"))
+				assert.Equal(t, `say "hi"`, store.String("quote"))
+			},
+		},
+		{
+			name:  "empty object",
+			input: `"a" {}`,
+			check: func(t *testing.T, root *Node) {
+				assert.True(t, root.Child("a").IsObject())
+				assert.Empty(t, root.Child("a").Children)
+			},
+		},
+		{name: "missing close", input: `"a" { "b" "c"`, wantErr: true},
+		{name: "missing value", input: `"a"`, wantErr: true},
+		{name: "unterminated string", input: `"a" "b`, wantErr: true},
+		{name: "stray close", input: `"a" "b" }`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root, err := Parse(strings.NewReader(tt.input))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.check != nil {
+				tt.check(t, root)
+			}
+		})
+	}
+}
+
+func TestWriteRoundTrip(t *testing.T) {
+	doc := NewObject("")
+	root := NewObject("AppState")
+	root.Set("appid", "376030")
+	root.Set("name", "ARK: \"Survival\" Evolved Dedicated Server")
+	userConfig := NewObject("UserConfig")
+	userConfig.Set("betakey", "")
+	root.Add(userConfig)
+	doc.Add(root)
+
+	buff := bytes.Buffer{}
+	assert.NoError(t, Write(&buff, doc))
+	parsed, err := Parse(&buff)
+	assert.NoError(t, err)
+	assert.Equal(t, doc, parsed)
+}
+
+func TestReadAppWorkshopFile(t *testing.T) {
+	a, err := ReadAppWorkshopFile("testdata/appworkshop_346110.acf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "346110", a.AppID)
+	assert.Equal(t, int64(1032741376), a.SizeOnDisk)
+	assert.Equal(t, WorkshopItemInstalled{
+		ID:          "731604991",
+		Size:        1015807232,
+		TimeUpdated: 1602871337,
+		Manifest:    "4893014226545467381",
+	}, a.WorkshopItemsInstalled["731604991"])
+	assert.Equal(t, int64(1603112200), a.WorkshopItemDetails["889745138"].TimeTouched)
+	assert.Equal(t, int64(0), a.WorkshopItemDetails["889745138"].LatestTimeUpdated)
+
+	buff := bytes.Buffer{}
+	assert.NoError(t, Write(&buff, a.Node()))
+	again, err := ParseAppWorkshop(&buff)
+	assert.NoError(t, err)
+	assert.Equal(t, a, again)
+}
+
+func TestReadAppManifestFile(t *testing.T) {
+	a, err := ReadAppManifestFile("testdata/appmanifest_376030.acf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, &AppState{
+		AppID:       "376030",
+		Name:        "ARK: Survival Evolved Dedicated Server",
+		InstallDir:  "ARK Survival Evolved Dedicated Server",
+		StateFlags:  4,
+		LastUpdated: 1602871337,
+		BuildID:     "5863244",
+		BetaKey:     "preaquatica",
+		SizeOnDisk:  20548743210,
+	}, a)
+}
+
+func TestBranchBuildID(t *testing.T) {
+	appInfo, err := Parse(strings.NewReader(`"376030"
+{
+	"common" { "name" "ARK: Survival Evolved Dedicated Server" }
+	"depots"
+	{
+		"branches"
+		{
+			"public" { "buildid" "6012853" "timeupdated" "1611238756" }
+			"preaquatica" { "buildid" "5863244" "pwdrequired" "1" }
+		}
+	}
+}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := appInfo.Child("376030")
+	buildID, err := BranchBuildID(app, "")
+	assert.NoError(t, err)
+	assert.Equal(t, "6012853", buildID)
+	buildID, err = BranchBuildID(app, "preaquatica")
+	assert.NoError(t, err)
+	assert.Equal(t, "5863244", buildID)
+	_, err = BranchBuildID(app, "missing")
+	assert.True(t, errors.Is(err, ErrNotFound))
+}
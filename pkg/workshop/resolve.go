@@ -0,0 +1,254 @@
+package workshop
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// fileTypeCollection marks a collection child which is a collection itself.
+	fileTypeCollection = 2
+	// maxListDepth limits @file lists including other lists.
+	maxListDepth = 8
+)
+
+// CollectionChild is an item or nested collection of a workshop collection.
+type CollectionChild struct {
+	ID        string
+	SortOrder int
+	FileType  int
+}
+
+// CollectionDetails returns the children of the given ids in their sort order.
+// Ids which are no collections have no children.
+func (c *Client) CollectionDetails(ctx context.Context, ids []string) (map[string][]CollectionChild, error) {
+	collections := map[string][]CollectionChild{}
+	if c.Offline {
+		for _, id := range ids {
+			children, ok := c.cachedCollection(id)
+			if !ok {
+				return nil, fmt.Errorf("%w: no cached collection details for %s", ErrOffline, id)
+			}
+			collections[id] = children
+		}
+		return collections, nil
+	}
+	for start := 0; start < len(ids); start += batchSize {
+		end := start + batchSize
+		if end > len(ids) {
+			end = len(ids)
+		}
+		form := url.Values{}
+		form.Set("collectioncount", strconv.Itoa(end-start))
+		for i, id := range ids[start:end] {
+			form.Set(fmt.Sprintf("publishedfileids[%d]", i), id)
+		}
+		var body struct {
+			Response struct {
+				Details []struct {
+					PublishedFileID string `json:"publishedfileid"`
+					Result          int    `json:"result"`
+					Children        []struct {
+						PublishedFileID string `json:"publishedfileid"`
+						SortOrder       int    `json:"sortorder"`
+						FileType        int    `json:"filetype"`
+					} `json:"children"`
+				} `json:"collectiondetails"`
+			} `json:"response"`
+		}
+		if err := c.post(ctx, "/ISteamRemoteStorage/GetCollectionDetails/v1/", form, &body); err != nil {
+			return nil, err
+		}
+		for _, d := range body.Response.Details {
+			var children []CollectionChild
+			for _, child := range d.Children {
+				children = append(children, CollectionChild{
+					ID:        child.PublishedFileID,
+					SortOrder: child.SortOrder,
+					FileType:  child.FileType,
+				})
+			}
+			sort.SliceStable(children, func(i, j int) bool {
+				return children[i].SortOrder < children[j].SortOrder
+			})
+			collections[d.PublishedFileID] = children
+			c.storeCollection(d.PublishedFileID, children)
+		}
+	}
+	return collections, nil
+}
+
+// RequiredItems returns the workshop items each of the given items lists as
+// required, in their sort order. steam reports them as the children of a
+// regular item in the collection details.
+func (c *Client) RequiredItems(ctx context.Context, ids []string) (map[string][]string, error) {
+	children, err := c.CollectionDetails(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	required := map[string][]string{}
+	for _, id := range ids {
+		for _, child := range children[id] {
+			required[id] = append(required[id], child.ID)
+		}
+	}
+	return required, nil
+}
+
+// Resolve turns mod references into a list of mod ids. A reference is a bare
+// id, a steamcommunity.com item url, a collection id or url, or @file with
+// one reference per line. Collections are expanded recursively. Duplicates
+// are dropped, keeping the position of the first occurrence.
+func (c *Client) Resolve(ctx context.Context, refs []string) ([]string, error) {
+	ids, err := ParseRefs(refs)
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	details, err := c.FileDetails(ctx, ids)
+	if errors.Is(err, ErrOffline) {
+		// refs without cached details are taken as mods, whether they are
+		// available is up to the mod cache
+		details = c.CachedFileDetails(ids)
+	} else if err != nil {
+		return nil, err
+	}
+	collections := map[string]bool{}
+	for id, d := range details {
+		collections[id] = d.IsCollection()
+	}
+	var resolved []string
+	seen := map[string]bool{}
+	if err := c.expand(ctx, ids, collections, seen, &resolved); err != nil {
+		return nil, err
+	}
+	return resolved, nil
+}
+
+func (c *Client) expand(ctx context.Context, ids []string, collections, seen map[string]bool, resolved *[]string) error {
+	var pending []string
+	for _, id := range ids {
+		if collections[id] && !seen[id] {
+			pending = append(pending, id)
+		}
+	}
+	children := map[string][]CollectionChild{}
+	if len(pending) > 0 {
+		var err error
+		if children, err = c.CollectionDetails(ctx, pending); err != nil {
+			return err
+		}
+	}
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		if !collections[id] {
+			*resolved = append(*resolved, id)
+			continue
+		}
+		childIDs := make([]string, 0, len(children[id]))
+		for _, child := range children[id] {
+			collections[child.ID] = child.FileType == fileTypeCollection
+			childIDs = append(childIDs, child.ID)
+		}
+		if err := c.expand(ctx, childIDs, collections, seen, resolved); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ParseRefs turns the references into workshop ids without asking steam, so
+// collections are not expanded.
+func ParseRefs(refs []string) ([]string, error) {
+	return parseRefs(refs, 0)
+}
+
+func parseRefs(refs []string, depth int) ([]string, error) {
+	var ids []string
+	for _, ref := range refs {
+		ref = strings.TrimSpace(ref)
+		switch {
+		case ref == "":
+			continue
+		case strings.HasPrefix(ref, "@"):
+			if depth >= maxListDepth {
+				return nil, fmt.Errorf("%s: mod lists nested too deep", ref)
+			}
+			lines, err := readRefFile(strings.TrimPrefix(ref, "@"))
+			if err != nil {
+				return nil, err
+			}
+			listed, err := parseRefs(lines, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			ids = append(ids, listed...)
+		default:
+			id, err := parseRef(ref)
+			if err != nil {
+				return nil, err
+			}
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+func parseRef(ref string) (string, error) {
+	if isID(ref) {
+		return ref, nil
+	}
+	u, err := url.Parse(ref)
+	if err != nil || u.Host == "" {
+		return "", fmt.Errorf("invalid mod reference %q", ref)
+	}
+	host := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+	if host != "steamcommunity.com" {
+		return "", fmt.Errorf("invalid mod reference %q: not a steamcommunity.com url", ref)
+	}
+	id := u.Query().Get("id")
+	if !isID(id) {
+		return "", fmt.Errorf("invalid mod reference %q: missing id", ref)
+	}
+	return id, nil
+}
+
+func isID(s string) bool {
+	if s == "" {
+		return false
+	}
+	_, err := strconv.ParseUint(s, 10, 64)
+	return err == nil
+}
+
+// readRefFile reads one reference per line, blank lines and lines starting
+// with # are ignored.
+func readRefFile(location string) ([]string, error) {
+	f, err := os.Open(location)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var refs []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		refs = append(refs, line)
+	}
+	return refs, scanner.Err()
+}
@@ -0,0 +1,109 @@
+package workshop
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRefs(t *testing.T) {
+	dir := t.TempDir()
+	list := filepath.Join(dir, "mods.txt")
+	nested := filepath.Join(dir, "more.txt")
+	assert.NoError(t, ioutil.WriteFile(list, []byte("# server mods\n731604991\n\n@"+nested+"\n"), 0644))
+	assert.NoError(t, ioutil.WriteFile(nested, []byte("https://steamcommunity.com/sharedfiles/filedetails/?id=889745138\n"), 0644))
+
+	tests := []struct {
+		name    string
+		refs    []string
+		want    []string
+		wantErr bool
+	}{
+		{name: "bare ids", refs: []string{"731604991", " 889745138 "}, want: []string{"731604991", "889745138"}},
+		{
+			name: "urls",
+			refs: []string{
+				"https://steamcommunity.com/sharedfiles/filedetails/?id=731604991",
+				"https://steamcommunity.com/workshop/filedetails/?id=889745138&searchtext=",
+				"http://www.steamcommunity.com/sharedfiles/filedetails/?l=german&id=751991809",
+			},
+			want: []string{"731604991", "889745138", "751991809"},
+		},
+		{name: "file list", refs: []string{"@" + list}, want: []string{"731604991", "889745138"}},
+		{name: "other host", refs: []string{"https://example.com/?id=731604991"}, wantErr: true},
+		{name: "url without id", refs: []string{"https://steamcommunity.com/app/346110/workshop/"}, wantErr: true},
+		{name: "not an id", refs: []string{"S+"}, wantErr: true},
+		{name: "missing file", refs: []string{"@" + filepath.Join(dir, "missing")}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseRefs(tt.refs)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseRefs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestParseRefsRecursiveList(t *testing.T) {
+	list := filepath.Join(t.TempDir(), "self.txt")
+	assert.NoError(t, ioutil.WriteFile(list, []byte("@"+list+"\n"), 0644))
+	_, err := ParseRefs([]string{"@" + list})
+	assert.Error(t, err)
+}
+
+func TestClient_Resolve(t *testing.T) {
+	collections := map[string][]string{
+		"1000": {"731604991", "1001", "889745138"},
+		"1001": {"751991809", "731604991", "1000"},
+		// required items of a regular mod must not expand it
+		"731604991": {"1999"},
+	}
+	server, _ := fakeAPI(t, testItems, collections)
+	client := NewClient(server.URL)
+
+	got, err := client.Resolve(context.Background(), []string{
+		"812655342",
+		"https://steamcommunity.com/sharedfiles/filedetails/?id=1000",
+		"889745138",
+		"812655342",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"812655342", "731604991", "751991809", "889745138"}, got)
+}
+
+func TestClient_RequiredItems(t *testing.T) {
+	server, _ := fakeAPI(t, testItems, map[string][]string{"731604991": {"1999", "1998"}})
+	required, err := NewClient(server.URL).RequiredItems(context.Background(), []string{"731604991", "889745138"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]string{"731604991": {"1999", "1998"}}, required)
+}
+
+func TestClient_ResolveOffline(t *testing.T) {
+	collections := map[string][]string{"1000": {"731604991", "889745138"}}
+	server, requests := fakeAPI(t, testItems, collections)
+	online := NewClient(server.URL)
+	online.CacheDir = t.TempDir()
+	_, err := online.Resolve(context.Background(), []string{"1000"})
+	assert.NoError(t, err)
+	seen := *requests
+
+	offline := NewClient(server.URL)
+	offline.CacheDir = online.CacheDir
+	offline.CacheTTL = 0
+	offline.Offline = true
+	got, err := offline.Resolve(context.Background(), []string{"1000", "812655342"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"731604991", "889745138", "812655342"}, got)
+	assert.Equal(t, seen, *requests)
+
+	_, err = offline.FileDetails(context.Background(), []string{"812655342"})
+	assert.True(t, errors.Is(err, ErrOffline), "got %v", err)
+	_, err = offline.RequiredItems(context.Background(), []string{"812655342"})
+	assert.True(t, errors.Is(err, ErrOffline), "got %v", err)
+}
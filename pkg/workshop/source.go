@@ -0,0 +1,24 @@
+package workshop
+
+import (
+	"context"
+
+	"github.com/d8x/amm/pkg/update"
+)
+
+// Latest implements update.Source with the published file details.
+// Removed or banned items are left out.
+func (c *Client) Latest(ctx context.Context, modIDs []string) (map[string]update.Version, error) {
+	details, err := c.FileDetails(ctx, modIDs)
+	if err != nil {
+		return nil, err
+	}
+	latest := map[string]update.Version{}
+	for id, d := range details {
+		if d.Check() != nil {
+			continue
+		}
+		latest[id] = update.Version{TimeUpdated: d.TimeUpdated, Manifest: d.Manifest}
+	}
+	return latest, nil
+}
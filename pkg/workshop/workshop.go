@@ -0,0 +1,337 @@
+// Package workshop is a client for the public Steam Web API endpoints
+// describing workshop items.
+package workshop
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultBaseURL = "https://api.steampowered.com"
+	arkGameID      = 346110
+	// batchSize is the number of ids sent in one request.
+	batchSize = 100
+	// resultOK is steam's EResult for a successful lookup.
+	resultOK = 1
+	// collectionsDir holds the cached collection details in CacheDir.
+	collectionsDir = "collections"
+)
+
+var (
+	ErrRemoved  = errors.New("workshop item was removed or is not public")
+	ErrBanned   = errors.New("workshop item is banned")
+	ErrWrongApp = errors.New("workshop item is not an ARK item")
+	// ErrOffline is returned when steam would have to be asked in offline mode.
+	ErrOffline = errors.New("steam is not available in offline mode")
+)
+
+// FileDetails are the published file details of one workshop item.
+type FileDetails struct {
+	ID            string   `json:"id"`
+	Result        int      `json:"result"`
+	Title         string   `json:"title"`
+	ConsumerAppID int      `json:"consumer_app_id"`
+	TimeCreated   int64    `json:"time_created"`
+	TimeUpdated   int64    `json:"time_updated"`
+	FileSize      int64    `json:"file_size"`
+	Manifest      string   `json:"manifest"`
+	Visibility    int      `json:"visibility"`
+	Banned        bool     `json:"banned"`
+	BanReason     string   `json:"ban_reason"`
+	Tags          []string `json:"tags"`
+	PreviewURL    string   `json:"preview_url"`
+}
+
+// Check reports why the item cannot be installed, nil means it can.
+func (d *FileDetails) Check() error {
+	switch {
+	case d.Result != resultOK:
+		return fmt.Errorf("%w: %s (result %d)", ErrRemoved, d.ID, d.Result)
+	case d.Banned:
+		return fmt.Errorf("%w: %s %s", ErrBanned, d.ID, d.BanReason)
+	case d.ConsumerAppID != 0 && d.ConsumerAppID != arkGameID:
+		return fmt.Errorf("%w: %s belongs to app %d", ErrWrongApp, d.ID, d.ConsumerAppID)
+	}
+	return nil
+}
+
+// IsCollection reports whether the item is a collection. Collections have
+// no content of their own.
+func (d *FileDetails) IsCollection() bool {
+	return d.Result == resultOK && d.Manifest == "" && d.FileSize == 0
+}
+
+// Client queries the Steam Web API. Responses are cached in memory and, when
+// CacheDir is set, on disk so repeated runs do not ask steam again.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	// CacheDir keeps the details on disk between runs when not empty.
+	CacheDir string
+	// CacheTTL is how long cached details are used, zero disables caching.
+	CacheTTL time.Duration
+	// Offline never asks steam and uses cached responses regardless of their age.
+	Offline bool
+
+	mu     sync.Mutex
+	memory map[string]cachedDetails
+}
+
+type cachedDetails struct {
+	Fetched time.Time    `json:"fetched"`
+	Details *FileDetails `json:"details"`
+}
+
+func NewClient(baseURL string) *Client {
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+	return &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: &http.Client{Timeout: time.Minute},
+		CacheTTL:   5 * time.Minute,
+		memory:     map[string]cachedDetails{},
+	}
+}
+
+// FileDetails looks up the given workshop items. Every requested id is part
+// of the result, items steam does not know have a Result other than 1.
+func (c *Client) FileDetails(ctx context.Context, ids []string) (map[string]*FileDetails, error) {
+	details := map[string]*FileDetails{}
+	var missing []string
+	for _, id := range ids {
+		if d, ok := c.cached(id); ok {
+			details[id] = d
+		} else if _, seen := details[id]; !seen {
+			missing = append(missing, id)
+			details[id] = nil
+		}
+	}
+	if c.Offline && len(missing) > 0 {
+		return nil, fmt.Errorf("%w: no cached details for %s", ErrOffline, strings.Join(missing, ", "))
+	}
+	for start := 0; start < len(missing); start += batchSize {
+		end := start + batchSize
+		if end > len(missing) {
+			end = len(missing)
+		}
+		fetched, err := c.fetchFileDetails(ctx, missing[start:end])
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range fetched {
+			details[d.ID] = d
+			c.store(d)
+		}
+	}
+	for id, d := range details {
+		if d == nil {
+			return nil, fmt.Errorf("steam returned no details for %s", id)
+		}
+	}
+	return details, nil
+}
+
+type publishedFileDetails struct {
+	PublishedFileID string    `json:"publishedfileid"`
+	Result          int       `json:"result"`
+	Title           string    `json:"title"`
+	ConsumerAppID   int       `json:"consumer_app_id"`
+	TimeCreated     flexInt64 `json:"time_created"`
+	TimeUpdated     flexInt64 `json:"time_updated"`
+	FileSize        flexInt64 `json:"file_size"`
+	HContentFile    string    `json:"hcontent_file"`
+	Visibility      int       `json:"visibility"`
+	Banned          int       `json:"banned"`
+	BanReason       string    `json:"ban_reason"`
+	PreviewURL      string    `json:"preview_url"`
+	Tags            []struct {
+		Tag string `json:"tag"`
+	} `json:"tags"`
+}
+
+func (c *Client) fetchFileDetails(ctx context.Context, ids []string) ([]*FileDetails, error) {
+	form := url.Values{}
+	form.Set("itemcount", strconv.Itoa(len(ids)))
+	for i, id := range ids {
+		form.Set(fmt.Sprintf("publishedfileids[%d]", i), id)
+	}
+	var body struct {
+		Response struct {
+			Result  int                    `json:"result"`
+			Details []publishedFileDetails `json:"publishedfiledetails"`
+		} `json:"response"`
+	}
+	if err := c.post(ctx, "/ISteamRemoteStorage/GetPublishedFileDetails/v1/", form, &body); err != nil {
+		return nil, err
+	}
+	var details []*FileDetails
+	for _, p := range body.Response.Details {
+		d := &FileDetails{
+			ID:            p.PublishedFileID,
+			Result:        p.Result,
+			Title:         p.Title,
+			ConsumerAppID: p.ConsumerAppID,
+			TimeCreated:   int64(p.TimeCreated),
+			TimeUpdated:   int64(p.TimeUpdated),
+			FileSize:      int64(p.FileSize),
+			Manifest:      p.HContentFile,
+			Visibility:    p.Visibility,
+			Banned:        p.Banned != 0,
+			BanReason:     p.BanReason,
+			PreviewURL:    p.PreviewURL,
+		}
+		for _, t := range p.Tags {
+			d.Tags = append(d.Tags, t.Tag)
+		}
+		details = append(details, d)
+	}
+	return details, nil
+}
+
+func (c *Client) post(ctx context.Context, endpoint string, form url.Values, v interface{}) error {
+	if c.Offline {
+		return fmt.Errorf("%w: %s", ErrOffline, endpoint)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("steam api %s: %s", endpoint, resp.Status)
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func (c *Client) cached(id string) (*FileDetails, bool) {
+	if c.CacheTTL <= 0 && !c.Offline {
+		return nil, false
+	}
+	c.mu.Lock()
+	entry, ok := c.memory[id]
+	c.mu.Unlock()
+	if !ok && c.CacheDir != "" {
+		data, err := ioutil.ReadFile(c.cacheFile(id))
+		if err == nil && json.Unmarshal(data, &entry) == nil && entry.Details != nil {
+			ok = true
+		}
+	}
+	if !ok || (!c.Offline && time.Since(entry.Fetched) > c.CacheTTL) {
+		return nil, false
+	}
+	return entry.Details, true
+}
+
+func (c *Client) store(d *FileDetails) {
+	entry := cachedDetails{Fetched: time.Now(), Details: d}
+	c.mu.Lock()
+	c.memory[d.ID] = entry
+	c.mu.Unlock()
+	if c.CacheDir == "" {
+		return
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(c.CacheDir, 0755); err != nil {
+		fmt.Printf("could not create workshop cache %v\n", err)
+		return
+	}
+	if err := ioutil.WriteFile(c.cacheFile(d.ID), data, 0644); err != nil {
+		fmt.Printf("could not write workshop cache %v\n", err)
+	}
+}
+
+func (c *Client) cacheFile(id string) string {
+	return filepath.Join(c.CacheDir, filepath.Base(id)+".json")
+}
+
+// CachedFileDetails returns the cached details of those ids which have any,
+// without asking steam.
+func (c *Client) CachedFileDetails(ids []string) map[string]*FileDetails {
+	details := map[string]*FileDetails{}
+	for _, id := range ids {
+		if d, ok := c.cached(id); ok {
+			details[id] = d
+		}
+	}
+	return details
+}
+
+// storeCollection keeps the children of an item on disk for offline use.
+func (c *Client) storeCollection(id string, children []CollectionChild) {
+	if c.CacheDir == "" {
+		return
+	}
+	data, err := json.Marshal(children)
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Join(c.CacheDir, collectionsDir), 0755); err != nil {
+		fmt.Printf("could not create workshop cache %v\n", err)
+		return
+	}
+	if err := ioutil.WriteFile(c.collectionFile(id), data, 0644); err != nil {
+		fmt.Printf("could not write workshop cache %v\n", err)
+	}
+}
+
+func (c *Client) cachedCollection(id string) ([]CollectionChild, bool) {
+	if c.CacheDir == "" {
+		return nil, false
+	}
+	data, err := ioutil.ReadFile(c.collectionFile(id))
+	if err != nil {
+		return nil, false
+	}
+	var children []CollectionChild
+	if err := json.Unmarshal(data, &children); err != nil {
+		return nil, false
+	}
+	return children, true
+}
+
+func (c *Client) collectionFile(id string) string {
+	return filepath.Join(c.CacheDir, collectionsDir, filepath.Base(id)+".json")
+}
+
+// flexInt64 accepts numbers encoded as json numbers or strings, the web api
+// uses both depending on the field and endpoint version.
+type flexInt64 int64
+
+func (f *flexInt64) UnmarshalJSON(data []byte) error {
+	s := strings.Trim(string(data), `"`)
+	if s == "" || s == "null" {
+		*f = 0
+		return nil
+	}
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return err
+	}
+	*f = flexInt64(v)
+	return nil
+}
@@ -0,0 +1,154 @@
+package workshop
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/d8x/amm/pkg/update"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeAPI serves GetPublishedFileDetails from items and GetCollectionDetails
+// from collections and counts the requests. collections also holds the
+// required items of regular items listed in items.
+func fakeAPI(t *testing.T, items map[string]string, collections map[string][]string) (*httptest.Server, *int) {
+	requests := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ISteamRemoteStorage/GetPublishedFileDetails/v1/", func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if err := r.ParseForm(); err != nil {
+			t.Fatal(err)
+		}
+		count, _ := strconv.Atoi(r.Form.Get("itemcount"))
+		details := ""
+		for i := 0; i < count; i++ {
+			id := r.Form.Get(fmt.Sprintf("publishedfileids[%d]", i))
+			item, ok := items[id]
+			if _, collection := collections[id]; collection && !ok {
+				item = fmt.Sprintf(`{"publishedfileid":"%s","result":1,"consumer_app_id":346110,"file_size":0,"title":"Collection"}`, id)
+			} else if !ok {
+				item = fmt.Sprintf(`{"publishedfileid":"%s","result":9}`, id)
+			}
+			if i > 0 {
+				details += ","
+			}
+			details += item
+		}
+		fmt.Fprintf(w, `{"response":{"result":1,"resultcount":%d,"publishedfiledetails":[%s]}}`, count, details)
+	})
+	mux.HandleFunc("/ISteamRemoteStorage/GetCollectionDetails/v1/", func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if err := r.ParseForm(); err != nil {
+			t.Fatal(err)
+		}
+		count, _ := strconv.Atoi(r.Form.Get("collectioncount"))
+		details := ""
+		for i := 0; i < count; i++ {
+			id := r.Form.Get(fmt.Sprintf("publishedfileids[%d]", i))
+			// children are sent in reverse to check the client sorts them
+			children := ""
+			for order := len(collections[id]) - 1; order >= 0; order-- {
+				child := collections[id][order]
+				fileType := 0
+				if _, ok := collections[child]; ok && items[child] == "" {
+					fileType = 2
+				}
+				if children != "" {
+					children += ","
+				}
+				children += fmt.Sprintf(`{"publishedfileid":"%s","sortorder":%d,"filetype":%d}`, child, order, fileType)
+			}
+			if i > 0 {
+				details += ","
+			}
+			details += fmt.Sprintf(`{"publishedfileid":"%s","result":1,"children":[%s]}`, id, children)
+		}
+		fmt.Fprintf(w, `{"response":{"result":1,"resultcount":%d,"collectiondetails":[%s]}}`, count, details)
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+var testItems = map[string]string{
+	"731604991": `{"publishedfileid":"731604991","result":1,"consumer_app_id":346110,"file_size":"1015807232",
+		"hcontent_file":"4893014226545467381","preview_url":"https://steamuserimages-a.akamaihd.net/ugc/1/","title":"Structures Plus (S+)",
+		"time_created":1466190843,"time_updated":1602871337,"visibility":0,"banned":0,"ban_reason":"","tags":[{"tag":"Mod"}]}`,
+	"889745138": `{"publishedfileid":"889745138","result":1,"consumer_app_id":346110,"file_size":16934144,
+		"hcontent_file":"1759318813204633104","title":"Awesome Teleporters!","time_updated":1598436512,"banned":1,"ban_reason":"copyright"}`,
+	"440900": `{"publishedfileid":"440900","result":1,"consumer_app_id":4000,"title":"Not ARK"}`,
+}
+
+func TestClient_FileDetails(t *testing.T) {
+	server, requests := fakeAPI(t, testItems, nil)
+	client := NewClient(server.URL)
+	client.CacheDir = t.TempDir()
+
+	details, err := client.FileDetails(context.Background(), []string{"731604991", "889745138", "440900", "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 1, *requests)
+	assert.Equal(t, &FileDetails{
+		ID:            "731604991",
+		Result:        1,
+		Title:         "Structures Plus (S+)",
+		ConsumerAppID: 346110,
+		TimeCreated:   1466190843,
+		TimeUpdated:   1602871337,
+		FileSize:      1015807232,
+		Manifest:      "4893014226545467381",
+		Tags:          []string{"Mod"},
+		PreviewURL:    "https://steamuserimages-a.akamaihd.net/ugc/1/",
+	}, details["731604991"])
+	assert.NoError(t, details["731604991"].Check())
+	assert.True(t, errors.Is(details["889745138"].Check(), ErrBanned))
+	assert.True(t, errors.Is(details["440900"].Check(), ErrWrongApp))
+	assert.True(t, errors.Is(details["1"].Check(), ErrRemoved))
+
+	// served from memory
+	_, err = client.FileDetails(context.Background(), []string{"731604991"})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, *requests)
+
+	// served from disk by a new client
+	other := NewClient(server.URL)
+	other.CacheDir = client.CacheDir
+	details, err = other.FileDetails(context.Background(), []string{"731604991", "731604991"})
+	assert.NoError(t, err)
+	assert.Equal(t, "Structures Plus (S+)", details["731604991"].Title)
+	assert.Equal(t, 1, *requests)
+
+	uncached := NewClient(server.URL)
+	uncached.CacheTTL = 0
+	_, err = uncached.FileDetails(context.Background(), []string{"731604991"})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, *requests)
+}
+
+func TestClient_FileDetailsBatches(t *testing.T) {
+	server, requests := fakeAPI(t, nil, nil)
+	var ids []string
+	for i := 0; i < 250; i++ {
+		ids = append(ids, strconv.Itoa(1000+i))
+	}
+	details, err := NewClient(server.URL).FileDetails(context.Background(), ids)
+	assert.NoError(t, err)
+	assert.Len(t, details, 250)
+	assert.Equal(t, 3, *requests)
+}
+
+func TestClient_Latest(t *testing.T) {
+	server, _ := fakeAPI(t, testItems, nil)
+	var source update.Source = NewClient(server.URL)
+	latest, err := source.Latest(context.Background(), []string{"731604991", "889745138", "1"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]update.Version{
+		"731604991": {TimeUpdated: 1602871337, Manifest: "4893014226545467381"},
+	}, latest)
+}